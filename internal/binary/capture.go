@@ -21,10 +21,22 @@ func (c capture) ToString() string {
 	return c.stdout.String()
 }
 
+func (c capture) StderrToString() string {
+	return c.stderr.String()
+}
+
 func (c capture) ToJson(structured bool) (interface{}, error) {
+	return toJson(c.stdout, structured)
+}
+
+func (c capture) StderrToJson(structured bool) (interface{}, error) {
+	return toJson(c.stderr, structured)
+}
+
+func toJson(buffer *bytes.Buffer, structured bool) (interface{}, error) {
 	var target []byte
 	if structured {
-		list := strings.Split(c.stdout.String(), "\n")
+		list := strings.Split(buffer.String(), "\n")
 		var filtered []string
 		for _, part := range list {
 			if len(part) > 0 {
@@ -33,7 +45,7 @@ func (c capture) ToJson(structured bool) (interface{}, error) {
 		}
 		target = []byte(fmt.Sprintf("[%s]", strings.Join(filtered, ",")))
 	} else {
-		target = c.stdout.Bytes()
+		target = buffer.Bytes()
 	}
 
 	var data interface{}
@@ -51,15 +63,21 @@ func (c capture) ToError() error {
 	return nil
 }
 
+// emptyCapture returns a capture that isn't attached to any command, for when
+// the output of a command can't be safely read.
+func emptyCapture() *capture {
+	return &capture{
+		stdout: &bytes.Buffer{},
+		stderr: &bytes.Buffer{},
+	}
+}
+
 // Capture returns a struct that captures the stdout and stderr for a given
 // exec.Cmd. This provides helpful functions for extracting JSON and errors from
 // stdout and stderr respectively.
 func Capture(cmd *exec.Cmd) *capture {
-	out := capture{
-		stdout: &bytes.Buffer{},
-		stderr: &bytes.Buffer{},
-	}
+	out := emptyCapture()
 	cmd.Stdout = out.stdout
 	cmd.Stderr = out.stderr
-	return &out
+	return out
 }
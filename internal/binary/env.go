@@ -0,0 +1,151 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package binary
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+var (
+	// DefaultAllowedEnv is the set of host environment variables that are
+	// still passed to the binary when the environment is isolated.
+	DefaultAllowedEnv = []string{
+		"PATH",
+		"LANG",
+		"LC_ALL",
+		"TZ",
+		"SYSTEMROOT", // Windows can't start processes without this.
+	}
+)
+
+// environment builds the environment that every command for a single test
+// should be executed with.
+//
+// The environment is built in layers, with later layers overriding earlier
+// ones: the host environment (filtered by the allowlist if the environment is
+// isolated), the per-test HOME, TMPDIR and TF_DATA_DIR directories if the
+// environment is isolated, the input variables, and finally the Env map.
+//
+// If the environment is isolated, the per-test directories are created inside
+// options.IsolatedDirectory. If that is empty, they are created inside a new
+// temporary directory instead. The returned cleanup function removes any
+// temporary directory, and must always be called.
+func (options Options) environment() ([]string, func(), error) {
+	cleanup := func() {}
+
+	var env []string
+	if options.IsolateEnv {
+		allowed := map[string]bool{}
+		for _, name := range DefaultAllowedEnv {
+			allowed[name] = true
+		}
+		for _, name := range options.AllowedEnv {
+			allowed[name] = true
+		}
+
+		for _, variable := range os.Environ() {
+			name := strings.SplitN(variable, "=", 2)[0]
+			if allowed[name] {
+				env = append(env, variable)
+			}
+		}
+
+		tmp := options.IsolatedDirectory
+		if len(tmp) == 0 {
+			var err error
+			if tmp, err = os.MkdirTemp("", "equivalence-testing"); err != nil {
+				return nil, cleanup, err
+			}
+			cleanup = func() {
+				os.RemoveAll(tmp)
+			}
+		}
+
+		for _, dir := range []struct{ name, dir string }{
+			{name: "HOME", dir: "home"},
+			{name: "TMPDIR", dir: "tmp"},
+			{name: "TF_DATA_DIR", dir: "data"},
+		} {
+			target := path.Join(tmp, dir.dir)
+			if err := os.MkdirAll(target, os.ModePerm); err != nil {
+				return nil, cleanup, err
+			}
+			env = append(env, fmt.Sprintf("%s=%s", dir.name, target))
+		}
+	} else {
+		env = os.Environ()
+	}
+
+	variables, err := variablesToEnv(options.Variables)
+	if err != nil {
+		return nil, cleanup, err
+	}
+	env = append(env, variables...)
+	env = append(env, mapToEnv(options.Env)...)
+
+	// We never want to return a nil environment, as exec.Cmd would interpret
+	// that as inheriting the whole host environment.
+	if env == nil {
+		env = []string{}
+	}
+	return env, cleanup, nil
+}
+
+// variablesToEnv converts the input variables into TF_VAR_ environment
+// variables. The keys are sorted so the environment is always built in the
+// same order.
+func variablesToEnv(variables map[string]interface{}) ([]string, error) {
+	var names []string
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var env []string
+	for _, name := range names {
+		switch value := variables[name].(type) {
+		case string:
+			env = append(env, fmt.Sprintf("TF_VAR_%s=%s", name, value))
+		default:
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("could not encode variable (%s): %v", name, err)
+			}
+			env = append(env, fmt.Sprintf("TF_VAR_%s=%s", name, data))
+		}
+	}
+	return env, nil
+}
+
+// commandEnv builds the environment for a single command from the environment
+// for the test and the environment variables specific to the command. The
+// command's variables come last, and take precedence, as exec.Cmd uses the
+// last value it finds for each name.
+func commandEnv(test []string, command []string) []string {
+	env := make([]string, 0, len(test)+len(command))
+	env = append(env, test...)
+	return append(env, command...)
+}
+
+// mapToEnv converts a map of environment variables into the KEY=value format
+// expected by exec.Cmd. The keys are sorted so the environment is always built
+// in the same order.
+func mapToEnv(variables map[string]string) []string {
+	var names []string
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var env []string
+	for _, name := range names {
+		env = append(env, fmt.Sprintf("%s=%s", name, variables[name]))
+	}
+	return env
+}
@@ -0,0 +1,199 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package binary
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// lookupEnv returns the value exec.Cmd would use for name, which is the last
+// one in env.
+func lookupEnv(env []string, name string) (string, bool) {
+	value, found := "", false
+	for _, variable := range env {
+		parts := strings.SplitN(variable, "=", 2)
+		if parts[0] == name {
+			value, found = parts[1], true
+		}
+	}
+	return value, found
+}
+
+func TestEnvironment(t *testing.T) {
+	t.Setenv("HOME", "/host/home")
+	t.Setenv("EQUIVALENCE_TESTING_ALLOWED", "allowed")
+	t.Setenv("EQUIVALENCE_TESTING_HIDDEN", "hidden")
+
+	directory := t.TempDir()
+
+	tcs := map[string]struct {
+		options  Options
+		expected map[string]string
+		missing  []string
+	}{
+		"host": {
+			options: Options{},
+			expected: map[string]string{
+				"HOME":                        "/host/home",
+				"EQUIVALENCE_TESTING_ALLOWED": "allowed",
+				"EQUIVALENCE_TESTING_HIDDEN":  "hidden",
+			},
+		},
+		"isolated": {
+			options: Options{
+				IsolateEnv:        true,
+				IsolatedDirectory: directory,
+			},
+			expected: map[string]string{
+				"HOME":        path.Join(directory, "home"),
+				"TMPDIR":      path.Join(directory, "tmp"),
+				"TF_DATA_DIR": path.Join(directory, "data"),
+			},
+			missing: []string{"EQUIVALENCE_TESTING_ALLOWED", "EQUIVALENCE_TESTING_HIDDEN"},
+		},
+		"allowed": {
+			options: Options{
+				IsolateEnv:        true,
+				IsolatedDirectory: directory,
+				AllowedEnv:        []string{"EQUIVALENCE_TESTING_ALLOWED", "HOME"},
+			},
+			expected: map[string]string{
+				// The isolated HOME still overrides the host HOME, even if it
+				// is allowed.
+				"HOME":                        path.Join(directory, "home"),
+				"EQUIVALENCE_TESTING_ALLOWED": "allowed",
+			},
+			missing: []string{"EQUIVALENCE_TESTING_HIDDEN"},
+		},
+		"variables": {
+			options: Options{
+				Variables: map[string]interface{}{
+					"name":  "value",
+					"count": 2,
+				},
+			},
+			expected: map[string]string{
+				"TF_VAR_name":  "value",
+				"TF_VAR_count": "2",
+			},
+		},
+		"env": {
+			options: Options{
+				IsolateEnv:        true,
+				IsolatedDirectory: directory,
+				Variables: map[string]interface{}{
+					"name": "variable",
+				},
+				Env: map[string]string{
+					"TF_VAR_name": "env",
+					"HOME":        "/env/home",
+				},
+			},
+			expected: map[string]string{
+				"TF_VAR_name": "env",
+				"HOME":        "/env/home",
+			},
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			env, cleanup, err := tc.options.environment()
+			defer cleanup()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for name, expected := range tc.expected {
+				if actual, ok := lookupEnv(env, name); !ok || actual != expected {
+					t.Errorf("expected %s=%q but found %q", name, expected, actual)
+				}
+			}
+			for _, name := range tc.missing {
+				if actual, ok := lookupEnv(env, name); ok {
+					t.Errorf("expected %s to be missing but found %q", name, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestEnvironmentTemporaryDirectory(t *testing.T) {
+	options := Options{IsolateEnv: true}
+
+	env, cleanup, err := options.environment()
+	if err != nil {
+		cleanup()
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	home, _ := lookupEnv(env, "HOME")
+	if _, err := os.Stat(home); err != nil {
+		t.Errorf("expected the isolated HOME to exist: %v", err)
+	}
+
+	cleanup()
+	if _, err := os.Stat(home); !os.IsNotExist(err) {
+		t.Errorf("expected the isolated HOME to be removed, but found %v", err)
+	}
+}
+
+func TestVariablesToEnv(t *testing.T) {
+	env, err := variablesToEnv(map[string]interface{}{
+		"string": "value",
+		"number": 1.5,
+		"list":   []interface{}{"a", "b"},
+		"object": map[string]interface{}{"key": "value"},
+		"bool":   true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"TF_VAR_bool=true",
+		"TF_VAR_list=[\"a\",\"b\"]",
+		"TF_VAR_number=1.5",
+		"TF_VAR_object={\"key\":\"value\"}",
+		"TF_VAR_string=value",
+	}
+	if diff := cmp.Diff(expected, env); len(diff) > 0 {
+		t.Errorf("unexpected environment:\n%s", diff)
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	options := Options{
+		Env: map[string]string{
+			"SHARED": "test",
+			"TEST":   "test",
+		},
+	}
+
+	test, cleanup, err := options.environment()
+	defer cleanup()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env := commandEnv(test, mapToEnv(map[string]string{
+		"SHARED":  "command",
+		"COMMAND": "command",
+	}))
+
+	for name, expected := range map[string]string{
+		"SHARED":  "command",
+		"TEST":    "test",
+		"COMMAND": "command",
+	} {
+		if actual, ok := lookupEnv(env, name); !ok || actual != expected {
+			t.Errorf("expected %s=%q but found %q", name, expected, actual)
+		}
+	}
+}
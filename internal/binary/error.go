@@ -8,13 +8,43 @@ import "fmt"
 // Error wraps an error returned by the executable. There are two
 // errors contained. Go is the error returned by the go exec framework, while
 // Binary is an error made up of the stderr output of the command.
+//
+// If the command was killed because it timed out, TimedOut is true and Output
+// contains whatever the command wrote to stdout before it was killed. If the
+// command was stopped, or never started, because the test was cancelled then
+// Cancelled is true.
 type Error struct {
-	Command string
-	Go      error
-	Binary  error
+	Command   string
+	Go        error
+	Binary    error
+	TimedOut  bool
+	Cancelled bool
+	Output    string
 }
 
 // Error makes our Error struct match the standard Go error interface.
 func (e Error) Error() string {
-	return fmt.Sprintf("binary command (%s) failed (%s) (%s)", e.Command, e.Go.Error(), e.Binary.Error())
+	status := "failed"
+	if e.TimedOut {
+		status = "timed out"
+	}
+	if e.Cancelled {
+		status = "was cancelled"
+	}
+
+	message := fmt.Sprintf("binary command (%s) %s (%s)", e.Command, status, e.Go.Error())
+	if e.Binary != nil {
+		// This can be nil if the binary didn't write anything to stderr.
+		message = fmt.Sprintf("%s (%s)", message, e.Binary.Error())
+	}
+	if e.TimedOut && len(e.Output) > 0 {
+		message = fmt.Sprintf("%s\npartial output:\n%s", message, e.Output)
+	}
+	return message
+}
+
+// Unwrap returns the error returned by the go exec framework, so callers can
+// use errors.As to inspect it.
+func (e Error) Unwrap() error {
+	return e.Go
 }
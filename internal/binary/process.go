@@ -0,0 +1,59 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package binary
+
+import (
+	"os/exec"
+	"sync"
+)
+
+// running tracks the commands that are currently executing.
+//
+// Every command is started in its own process group, so it can be killed
+// along with its children when it times out. This means an interrupt from the
+// terminal only reaches the framework, which cancels the context of the
+// commands to interrupt them, or uses KillRunning to stop them immediately.
+var running = struct {
+	sync.Mutex
+	commands map[*exec.Cmd]bool
+	killed   bool
+}{
+	commands: map[*exec.Cmd]bool{},
+}
+
+// track records that cmd has started, and returns a function that must be
+// called once it has exited.
+func track(cmd *exec.Cmd) func() {
+	running.Lock()
+	defer running.Unlock()
+
+	if running.killed {
+		// Then the command started while we were killing everything, so it
+		// should be killed as well.
+		killProcessGroup(cmd)
+	}
+
+	running.commands[cmd] = true
+	return func() {
+		running.Lock()
+		defer running.Unlock()
+		delete(running.commands, cmd)
+	}
+}
+
+// KillRunning kills every command that is currently executing, along with any
+// processes they started, and any command that starts afterwards.
+//
+// Unlike cancelling their context, the commands don't get a chance to exit
+// cleanly. The functions running the commands still return as normal, so
+// temporary directories are removed.
+func KillRunning() {
+	running.Lock()
+	defer running.Unlock()
+
+	running.killed = true
+	for cmd := range running.commands {
+		killProcessGroup(cmd)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !windows
+
+package binary
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes sure the command is started in its own process group,
+// so that killProcessGroup can stop the command and any children it started.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// interruptProcessGroup sends SIGINT to the command and any children it
+// started, giving them a chance to exit cleanly.
+func interruptProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGINT)
+}
+
+// killProcessGroup kills the command and any children it started.
+func killProcessGroup(cmd *exec.Cmd) error {
+	// A negative pid sends the signal to every process in the group.
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
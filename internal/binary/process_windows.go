@@ -0,0 +1,36 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build windows
+
+package binary
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes sure the command is started in its own process group,
+// so that killProcessGroup can stop the command and any children it started.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+var generateConsoleCtrlEvent = syscall.NewLazyDLL("kernel32.dll").NewProc("GenerateConsoleCtrlEvent")
+
+// interruptProcessGroup sends a Ctrl-Break event to the process group of the
+// command, which is the closest Windows has to SIGINT.
+func interruptProcessGroup(cmd *exec.Cmd) error {
+	if ok, _, err := generateConsoleCtrlEvent.Call(syscall.CTRL_BREAK_EVENT, uintptr(cmd.Process.Pid)); ok == 0 {
+		return err
+	}
+	return nil
+}
+
+// killProcessGroup kills the command.
+//
+// Windows has no simple equivalent to killing a whole process group, so any
+// children started by the command may outlive it.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -5,16 +5,26 @@ package binary
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform-exec/tfexec"
 
 	"github.com/opentofu/equivalence-testing/internal/files"
 )
 
+const (
+	// PlanFile is the name of the plan file written by the default plan
+	// command, relative to the directory the test is executed in.
+	PlanFile = "equivalence_test_plan"
+)
+
 // Command is a struct that instructs the framework how to execute a custom
 // command. It covers the arguments that should be passed to the binary, and
 // instructs whether the output should be captured and how it should be
@@ -22,21 +32,21 @@ import (
 type Command struct {
 	// The Name of the command to execute. This field is used for logging when
 	// reporting which command might have failed.
-	Name string `json:"name"`
+	Name string `json:"name,omitempty"`
 
 	// A list of Arguments to pass to the binary, eg. `init`, `plan`,
 	// `show -json`, etc.
-	Arguments []string `json:"arguments"`
+	Arguments []string `json:"arguments,omitempty"`
 
 	// CaptureOutput should be set to true if we want to record the output of
 	// this command and compare/copy it into the golden files.
-	CaptureOutput bool `json:"capture_output"`
+	CaptureOutput bool `json:"capture_output,omitempty"`
 
 	// OutputFileName is the name of the file that the framework should write
 	// the captured output into.
 	//
 	// This field is ignored if CaptureOutput is false.
-	OutputFileName string `json:"output_file_name"`
+	OutputFileName string `json:"output_file_name,omitempty"`
 
 	// HasJsonOutput tells the framework the output is going to be in JSON
 	// format.
@@ -46,7 +56,7 @@ type Command struct {
 	// output as JSON is easier to diff and display than raw strings.
 	//
 	// This field is ignored if CaptureOutput is false.
-	HasJsonOutput bool `json:"has_json_output"`
+	HasJsonOutput bool `json:"has_json_output,omitempty"`
 
 	// StreamsJsonOutput tells the framework the output isn't going to arrive in
 	// pure JSON but as a list of structured JSON statements. In this case the
@@ -60,7 +70,101 @@ type Command struct {
 	//
 	// This field is ignored if CaptureOutput is false or if HasJsonOutput is
 	// false.
-	StreamsJsonOutput bool `json:"streams_json_output"`
+	StreamsJsonOutput bool `json:"streams_json_output,omitempty"`
+
+	// Env contains additional environment variables for this command only.
+	// These override any environment variables set for the whole test.
+	Env map[string]string `json:"env,omitempty"`
+
+	// ExpectFailure tells the framework this command should exit with a
+	// non-zero exit code. The test fails if the command succeeds instead.
+	//
+	// The output of a failing command is captured as normal, so combining this
+	// with CaptureOutput and the -json argument records the diagnostics.
+	ExpectFailure bool `json:"expect_failure,omitempty"`
+
+	// ExpectedExitCode is the exit code the command should fail with. If this
+	// is 0, then any non-zero exit code is accepted.
+	//
+	// This field is ignored if ExpectFailure is false.
+	ExpectedExitCode int `json:"expected_exit_code,omitempty"`
+
+	// StderrFileName is the name of the file that the framework should write
+	// the stderr output of the command into. If this is empty, stderr is not
+	// captured.
+	//
+	// This works for both successful and failed commands, so warnings and
+	// deprecation notices can be recorded in the golden files.
+	StderrFileName string `json:"stderr_file_name,omitempty"`
+
+	// StderrHasJsonOutput and StderrStreamsJsonOutput behave exactly like
+	// HasJsonOutput and StreamsJsonOutput, except they apply to the stderr
+	// output of the command.
+	//
+	// These fields are ignored if StderrFileName is empty.
+	StderrHasJsonOutput     bool `json:"stderr_has_json_output,omitempty"`
+	StderrStreamsJsonOutput bool `json:"stderr_streams_json_output,omitempty"`
+
+	// ExitCodeFileName is the name of the file that the framework should write
+	// the exit code of the failed command into. If this is empty, the exit
+	// code is not captured.
+	//
+	// This field is ignored if ExpectFailure is false.
+	ExitCodeFileName string `json:"exit_code_file_name,omitempty"`
+
+	// Timeout is the maximum time a single attempt of this command can take,
+	// eg. "5m". If this is zero, then only the timeout for the whole test
+	// applies.
+	Timeout Duration `json:"timeout,omitempty"`
+
+	// Retries is the number of times this command is executed again if it
+	// fails or times out. The test only fails if every attempt fails.
+	Retries int `json:"retries,omitempty"`
+}
+
+// Options contains the settings for a single equivalence test that apply to
+// all the commands executed by ExecuteTest.
+type Options struct {
+	// Variables are passed into every command as TF_VAR_ environment
+	// variables. String values are passed as is, while any other values are
+	// encoded as JSON which the binary will parse as an HCL expression.
+	Variables map[string]interface{}
+
+	// VarFiles are passed into the default plan command using the -var-file
+	// argument. The apply command reuses the values stored in the saved plan.
+	VarFiles []string
+
+	// Env contains additional environment variables that are passed into
+	// every command.
+	Env map[string]string
+
+	// IsolateEnv tells the framework to only pass the host environment
+	// variables in DefaultAllowedEnv and AllowedEnv to the binary. HOME,
+	// TMPDIR and TF_DATA_DIR are also pointed at fresh directories that are
+	// unique to the test.
+	IsolateEnv bool
+
+	// AllowedEnv contains the names of additional host environment variables
+	// that should be passed to the binary when IsolateEnv is true.
+	AllowedEnv []string
+
+	// IsolatedDirectory is the directory that the isolated HOME, TMPDIR and
+	// TF_DATA_DIR directories are created in. Setting this lets multiple calls
+	// to ExecuteTest share the same directories. If this is empty, a temporary
+	// directory is used for the duration of a single call to ExecuteTest.
+	//
+	// This field is ignored if IsolateEnv is false.
+	IsolatedDirectory string
+
+	// Codecs overrides the codec that reads each additional file, keyed by
+	// file name or glob pattern. Files without an override are read with the
+	// codec for their extension.
+	Codecs files.CodecOverrides
+
+	// Deadline is the time by which every command for the test must have
+	// finished. Any command still running at this time is killed. If this is
+	// zero, there is no deadline.
+	Deadline time.Time
 }
 
 // Binary is an interface that can execute a single equivalence test within a
@@ -71,15 +175,30 @@ type Binary interface {
 	// ExecuteTest executes a series of commands in order and returns the
 	// output of the apply and plan steps, the state, and any additionally
 	// requested files.
-	ExecuteTest(directory string, includeFiles []string, commands ...Command) (map[string]*files.File, error)
+	//
+	// The additional files are found, using the includeFiles patterns, after
+	// every command has finished. Each file is returned under its path
+	// relative to directory.
+	//
+	// If ctx is cancelled, no further commands are started and any running
+	// command is interrupted, see InterruptGracePeriod.
+	ExecuteTest(ctx context.Context, directory string, options Options, includeFiles files.Patterns, commands ...Command) (map[string]*files.File, error)
 
 	// Version returns the version of the underlying binary.
 	Version() string
+
+	// Flavor returns the flavor of the underlying binary, eg. "tofu" or
+	// "terraform".
+	Flavor() string
 }
 
 // New returns a Binary compatible struct that executes the tests using the
 // selected binary provided in the argument.
-func New(binaryName string) (Binary, error) {
+//
+// The flavor identifies which product the binary is, so golden files can vary
+// between them. If flavor is empty, the file name of the binary is used (eg.
+// "tofu" for /usr/local/bin/tofu).
+func New(binaryName string, flavor string) (Binary, error) {
 
 	// First, sanity check binary actually points to a binary file.
 	//
@@ -102,27 +221,65 @@ func New(binaryName string) (Binary, error) {
 		return nil, err
 	}
 
+	if len(flavor) == 0 {
+		flavor = strings.TrimSuffix(filepath.Base(binaryName), filepath.Ext(binaryName))
+	}
+
 	return &binary{
 		binary:  binaryName,
 		version: version.String(),
+		flavor:  flavor,
 	}, nil
 }
 
+const (
+	// InterruptGracePeriod is how long a command has to exit after it is
+	// interrupted, before it is killed.
+	InterruptGracePeriod = 10 * time.Second
+
+	// KillWaitPeriod is how long we wait for a command to finish after it is
+	// killed. A process started by the command can hold the output of the
+	// command open after the command itself has exited, so we can't always
+	// wait for it.
+	KillWaitPeriod = 5 * time.Second
+)
+
+// interruptGracePeriod is the grace period used by run. It is only changed by
+// the tests, so they don't have to wait for the full InterruptGracePeriod.
+var interruptGracePeriod = InterruptGracePeriod
+
 type binary struct {
-	binary  string
-	version string
-	dir     string
+	binary   string
+	version  string
+	flavor   string
+	dir      string
+	env      []string
+	deadline time.Time
+	ctx      context.Context
 }
 
 func (t *binary) Version() string {
 	return t.version
 }
 
-func (tro *binary) ExecuteTest(directory string, includeFiles []string, commands ...Command) (map[string]*files.File, error) {
+func (t *binary) Flavor() string {
+	return t.flavor
+}
+
+func (tro *binary) ExecuteTest(ctx context.Context, directory string, options Options, includeFiles files.Patterns, commands ...Command) (map[string]*files.File, error) {
 	var err error
-	// Copy the struct and modify the directory field
+	// Copy the struct and modify the directory and environment fields
 	t := *tro
 	t.dir = directory
+	t.deadline = options.Deadline
+	t.ctx = ctx
+
+	var cleanup func()
+	t.env, cleanup, err = options.environment()
+	defer cleanup()
+	if err != nil {
+		return nil, err
+	}
 
 	savedFiles := map[string]*files.File{}
 	if len(commands) == 0 {
@@ -132,7 +289,7 @@ func (tro *binary) ExecuteTest(directory string, includeFiles []string, commands
 		if err := t.init(); err != nil {
 			return nil, err
 		}
-		if savedFiles["plan"], err = t.plan(); err != nil {
+		if savedFiles["plan"], err = t.plan(options.VarFiles); err != nil {
 			return nil, err
 		}
 		if savedFiles["apply.json"], err = t.apply(); err != nil {
@@ -149,23 +306,28 @@ func (tro *binary) ExecuteTest(directory string, includeFiles []string, commands
 		}
 	} else {
 		for _, command := range commands {
-			output, err := t.command(command)
+			outputs, err := t.command(command)
 			if err != nil {
 				return nil, err
 			}
 
-			if output != nil {
-				savedFiles[command.OutputFileName] = output
+			for name, output := range outputs {
+				savedFiles[name] = output
 			}
 		}
 	}
 
-	for _, includeFile := range includeFiles {
+	found, err := includeFiles.Find(t.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, includeFile := range found {
 		raw, err := os.ReadFile(path.Join(t.dir, includeFile))
 		if err != nil {
 			return nil, fmt.Errorf("could not read additional file (%s): %v", includeFile, err)
 		}
-		if savedFiles[includeFile], err = files.NewFile(includeFile, raw); err != nil {
+		if savedFiles[includeFile], err = options.Codecs.NewFile(includeFile, raw); err != nil {
 			return nil, fmt.Errorf("could not unmarshal additional file (%s): %v", includeFile, err)
 		}
 	}
@@ -173,43 +335,109 @@ func (tro *binary) ExecuteTest(directory string, includeFiles []string, commands
 	return savedFiles, nil
 }
 
-func (t *binary) command(command Command) (*files.File, error) {
-	capture, err := t.run(exec.Command(t.binary, command.Arguments...), command.Name)
+func (t *binary) command(command Command) (map[string]*files.File, error) {
+	var captured *capture
+	var exitCode int
+	var err error
+
+	for attempt := 0; attempt <= command.Retries; attempt++ {
+		if captured, exitCode, err = t.attempt(command); err == nil || t.ctx.Err() != nil {
+			// There's no point retrying a command that was cancelled.
+			break
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	outputs := map[string]*files.File{}
+	if command.ExpectFailure && len(command.ExitCodeFileName) > 0 {
+		outputs[command.ExitCodeFileName] = files.NewRawFile(fmt.Sprintf("%d\n", exitCode))
+	}
+
+	if len(command.StderrFileName) > 0 {
+		if !command.StderrHasJsonOutput {
+			outputs[command.StderrFileName] = files.NewRawFile(captured.StderrToString())
+		} else {
+			json, err := captured.StderrToJson(command.StderrStreamsJsonOutput)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse stderr of command (%s): %v", command.Name, err)
+			}
+			outputs[command.StderrFileName] = files.NewJsonFile(json)
+		}
+	}
+
 	if !command.CaptureOutput {
-		return nil, nil
+		return outputs, nil
 	}
 
 	if !command.HasJsonOutput {
-		return files.NewRawFile(capture.ToString()), nil
+		outputs[command.OutputFileName] = files.NewRawFile(captured.ToString())
+		return outputs, nil
 	}
 
-	var json interface{}
-	if command.StreamsJsonOutput {
-		if json, err = capture.ToJson(true); err != nil {
-			return nil, err
+	json, err := captured.ToJson(command.StreamsJsonOutput)
+	if err != nil {
+		return nil, err
+	}
+	outputs[command.OutputFileName] = files.NewJsonFile(json)
+	return outputs, nil
+}
+
+// attempt executes the command once, and checks the outcome matches what the
+// command expects. It returns the captured output and the exit code of the
+// command.
+func (t *binary) attempt(command Command) (*capture, int, error) {
+	cmd := exec.Command(t.binary, command.Arguments...)
+	cmd.Env = mapToEnv(command.Env)
+
+	capture, err := t.run(cmd, command.Name, time.Duration(command.Timeout))
+
+	if !command.ExpectFailure {
+		return capture, 0, err
+	}
+
+	if err == nil {
+		return nil, 0, Error{
+			Command: command.Name,
+			Go:      errors.New("expected the command to fail but it succeeded"),
+			Binary:  capture.ToError(),
 		}
-	} else {
-		if json, err = capture.ToJson(false); err != nil {
-			return nil, err
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		// Then the command didn't fail because of the binary, something went
+		// wrong actually executing it or it timed out.
+		return nil, 0, err
+	}
+
+	exitCode := exitErr.ExitCode()
+	if command.ExpectedExitCode != 0 && command.ExpectedExitCode != exitCode {
+		return nil, 0, Error{
+			Command: command.Name,
+			Go:      fmt.Errorf("expected exit code %d but found %d", command.ExpectedExitCode, exitCode),
+			Binary:  capture.ToError(),
 		}
 	}
-	return files.NewJsonFile(json), nil
+	return capture, exitCode, nil
 }
 
 func (t *binary) init() error {
-	_, err := t.run(exec.Command(t.binary, "init"), "init")
+	_, err := t.run(exec.Command(t.binary, "init"), "init", 0)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (t *binary) plan() (*files.File, error) {
-	capture, err := t.run(exec.Command(t.binary, "plan", "-out=equivalence_test_plan", "-no-color"), "plan")
+func (t *binary) plan(varFiles []string) (*files.File, error) {
+	args := []string{"plan", "-out=" + PlanFile, "-no-color"}
+	for _, varFile := range varFiles {
+		args = append(args, "-var-file="+varFile)
+	}
+
+	capture, err := t.run(exec.Command(t.binary, args...), "plan", 0)
 	if err != nil {
 		return nil, err
 	}
@@ -217,7 +445,7 @@ func (t *binary) plan() (*files.File, error) {
 }
 
 func (t *binary) apply() (*files.File, error) {
-	capture, err := t.run(exec.Command(t.binary, "apply", "-json", "equivalence_test_plan"), "apply")
+	capture, err := t.run(exec.Command(t.binary, "apply", "-json", PlanFile), "apply", 0)
 	if err != nil {
 		return nil, err
 	}
@@ -230,7 +458,7 @@ func (t *binary) apply() (*files.File, error) {
 }
 
 func (t *binary) showState() (*files.File, error) {
-	capture, err := t.run(exec.Command(t.binary, "show", "-no-color"), "show state")
+	capture, err := t.run(exec.Command(t.binary, "show", "-no-color"), "show state", 0)
 	if err != nil {
 		return nil, err
 	}
@@ -238,7 +466,7 @@ func (t *binary) showState() (*files.File, error) {
 }
 
 func (t *binary) showJsonPlan() (*files.File, error) {
-	capture, err := t.run(exec.Command(t.binary, "show", "-json", "equivalence_test_plan"), "show json plan")
+	capture, err := t.run(exec.Command(t.binary, "show", "-json", PlanFile), "show json plan", 0)
 	if err != nil {
 		return nil, err
 	}
@@ -251,7 +479,7 @@ func (t *binary) showJsonPlan() (*files.File, error) {
 }
 
 func (t *binary) showJsonState() (*files.File, error) {
-	capture, err := t.run(exec.Command(t.binary, "show", "-json"), "show json state")
+	capture, err := t.run(exec.Command(t.binary, "show", "-json"), "show json state", 0)
 	if err != nil {
 		return nil, err
 	}
@@ -263,15 +491,145 @@ func (t *binary) showJsonState() (*files.File, error) {
 	return files.NewJsonFile(json), nil
 }
 
-func (t *binary) run(cmd *exec.Cmd, command string) (*capture, error) {
+// run executes cmd and captures its output.
+//
+// If timeout is not zero, or the test has a deadline, then the command (and any
+// processes it started) is killed if it runs for too long. If the context is
+// cancelled, the command is interrupted and then killed if it doesn't exit
+// within the InterruptGracePeriod.
+func (t *binary) run(cmd *exec.Cmd, command string, timeout time.Duration) (*capture, error) {
 	cmd.Dir = t.dir
+
+	if err := t.ctx.Err(); err != nil {
+		return Capture(cmd), Error{
+			Command:   command,
+			Go:        err,
+			Cancelled: true,
+		}
+	}
+
+	cmd.Env = commandEnv(t.env, cmd.Env)
+
+	reason := fmt.Sprintf("the command reached its %s timeout", timeout)
+	if !t.deadline.IsZero() {
+		remaining := time.Until(t.deadline)
+		if remaining <= 0 {
+			return Capture(cmd), Error{
+				Command:  command,
+				Go:       errors.New("the test ran out of time before the command started"),
+				TimedOut: true,
+			}
+		}
+
+		if timeout == 0 || remaining < timeout {
+			timeout = remaining
+			reason = "the test reached its timeout"
+		}
+	}
+
+	setProcessGroup(cmd)
 	capture := Capture(cmd)
-	if err := cmd.Run(); err != nil {
+	if err := cmd.Start(); err != nil {
 		return capture, Error{
 			Command: command,
 			Go:      err,
 			Binary:  capture.ToError(),
 		}
 	}
-	return capture, nil
+	defer track(cmd)()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return capture, Error{
+				Command: command,
+				Go:      err,
+				Binary:  capture.ToError(),
+			}
+		}
+		return capture, nil
+	case <-expired:
+		if err := kill(cmd, done); err != nil {
+			return emptyCapture(), Error{
+				Command:  command,
+				Go:       fmt.Errorf("%s, and %v", reason, err),
+				TimedOut: true,
+			}
+		}
+
+		return capture, Error{
+			Command:  command,
+			Go:       errors.New(reason),
+			Binary:   capture.ToError(),
+			TimedOut: true,
+			Output:   capture.ToString(),
+		}
+	case <-t.ctx.Done():
+		if err := interruptProcessGroup(cmd); err == nil {
+			timer := time.NewTimer(interruptGracePeriod)
+			defer timer.Stop()
+
+			select {
+			case <-done:
+				return capture, Error{
+					Command:   command,
+					Go:        t.ctx.Err(),
+					Binary:    capture.ToError(),
+					Cancelled: true,
+				}
+			case <-timer.C:
+			}
+		}
+
+		// Either the command couldn't be interrupted, or it didn't exit in
+		// time, so we kill it instead.
+		if err := kill(cmd, done); err != nil {
+			return emptyCapture(), Error{
+				Command:   command,
+				Go:        fmt.Errorf("%v, and %v", t.ctx.Err(), err),
+				Cancelled: true,
+			}
+		}
+
+		return capture, Error{
+			Command:   command,
+			Go:        t.ctx.Err(),
+			Binary:    capture.ToError(),
+			Cancelled: true,
+		}
+	}
+}
+
+// kill kills cmd, and any processes it started, and then waits for done to
+// report the command has finished so the captured output is complete.
+//
+// If the command doesn't finish within KillWaitPeriod, kill returns an error
+// and the captured output of the command must not be read as it could still
+// be being written.
+func kill(cmd *exec.Cmd, done <-chan error) error {
+	if err := killProcessGroup(cmd); err != nil {
+		return fmt.Errorf("the process could not be killed: %v", err)
+	}
+
+	timer := time.NewTimer(KillWaitPeriod)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("the output of the process was still open %s after it was killed", KillWaitPeriod)
+	}
 }
@@ -0,0 +1,464 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !windows
+
+package binary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/opentofu/equivalence-testing/internal/files"
+)
+
+// fakeBinary returns a binary that runs script with /bin/sh, so the tests can
+// control exactly what a command writes and how it exits. The arguments of
+// each command are available to the script as $1, $2, etc.
+func fakeBinary(t *testing.T, script string) *binary {
+	t.Helper()
+
+	name := path.Join(t.TempDir(), "fake")
+	if err := os.WriteFile(name, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &binary{
+		binary:  name,
+		version: "1.6.0",
+		flavor:  "fake",
+	}
+}
+
+// rawFiles returns the contents of each of the raw files in outputs.
+func rawFiles(t *testing.T, outputs map[string]*files.File) map[string]string {
+	t.Helper()
+
+	ret := map[string]string{}
+	for name, file := range outputs {
+		contents, ok := file.String()
+		if !ok {
+			t.Fatalf("expected %s to be a raw file", name)
+		}
+		ret[name] = contents
+	}
+	return ret
+}
+
+func TestExecuteTestExpectFailure(t *testing.T) {
+	tf := fakeBinary(t, `echo "output"; echo "broken" >&2; exit 2`)
+
+	tcs := map[string]struct {
+		command  Command
+		expected map[string]string
+		err      string
+	}{
+		"expected failure": {
+			command: Command{
+				Name:             "fail",
+				CaptureOutput:    true,
+				OutputFileName:   "output",
+				ExpectFailure:    true,
+				ExitCodeFileName: "exit_code",
+			},
+			expected: map[string]string{
+				"output":    "output\n",
+				"exit_code": "2\n",
+			},
+		},
+		"expected exit code": {
+			command: Command{
+				Name:             "fail",
+				ExpectFailure:    true,
+				ExpectedExitCode: 2,
+				ExitCodeFileName: "exit_code",
+			},
+			expected: map[string]string{
+				"exit_code": "2\n",
+			},
+		},
+		"wrong exit code": {
+			command: Command{
+				Name:             "fail",
+				ExpectFailure:    true,
+				ExpectedExitCode: 3,
+			},
+			err: "binary command (fail) failed (expected exit code 3 but found 2) (broken\n)",
+		},
+		"unexpected failure": {
+			command: Command{
+				Name:           "fail",
+				CaptureOutput:  true,
+				OutputFileName: "output",
+			},
+			err: "binary command (fail) failed (exit status 2) (broken\n)",
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			outputs, err := tf.ExecuteTest(context.Background(), t.TempDir(), Options{}, files.Patterns{}, tc.command)
+			if len(tc.err) > 0 {
+				if err == nil {
+					t.Fatalf("expected an error but found none")
+				}
+				var binaryErr Error
+				if !errors.As(err, &binaryErr) {
+					t.Fatalf("expected a binary.Error, found %T", err)
+				}
+				if err.Error() != tc.err {
+					t.Fatalf("expected error %q, found %q", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			actual := rawFiles(t, outputs)
+			for name, contents := range tc.expected {
+				if actual[name] != contents {
+					t.Errorf("expected %s to be %q, found %q", name, contents, actual[name])
+				}
+			}
+			if len(actual) != len(tc.expected) {
+				t.Errorf("expected %d files, found %d", len(tc.expected), len(actual))
+			}
+		})
+	}
+}
+
+func TestExecuteTestExpectFailureSucceeds(t *testing.T) {
+	tf := fakeBinary(t, `echo "output"`)
+
+	_, err := tf.ExecuteTest(context.Background(), t.TempDir(), Options{}, files.Patterns{}, Command{
+		Name:          "succeed",
+		ExpectFailure: true,
+	})
+	if err == nil {
+		t.Fatalf("expected an error but found none")
+	}
+	if !strings.Contains(err.Error(), "expected the command to fail but it succeeded") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestExecuteTestStderr(t *testing.T) {
+	tcs := map[string]struct {
+		script   string
+		command  Command
+		expected interface{}
+	}{
+		"raw": {
+			script: `echo "output"; echo "Warning: deprecated" >&2`,
+			command: Command{
+				Name:           "warn",
+				StderrFileName: "warn.stderr",
+			},
+			expected: "Warning: deprecated\n",
+		},
+		"raw failure": {
+			script: `echo "Error: broken" >&2; exit 1`,
+			command: Command{
+				Name:           "fail",
+				ExpectFailure:  true,
+				StderrFileName: "fail.stderr",
+			},
+			expected: "Error: broken\n",
+		},
+		"json": {
+			script: `echo '{"diagnostics": [{"severity": "warning"}]}' >&2`,
+			command: Command{
+				Name:                "validate",
+				StderrFileName:      "validate.stderr.json",
+				StderrHasJsonOutput: true,
+			},
+			expected: map[string]interface{}{
+				"diagnostics": []interface{}{
+					map[string]interface{}{"severity": "warning"},
+				},
+			},
+		},
+		"streamed json": {
+			script: `echo '{"@level": "warn"}' >&2; echo '{"@level": "error"}' >&2`,
+			command: Command{
+				Name:                    "apply",
+				StderrFileName:          "apply.stderr.json",
+				StderrHasJsonOutput:     true,
+				StderrStreamsJsonOutput: true,
+			},
+			expected: []interface{}{
+				map[string]interface{}{"@level": "warn"},
+				map[string]interface{}{"@level": "error"},
+			},
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			tf := fakeBinary(t, tc.script)
+
+			outputs, err := tf.ExecuteTest(context.Background(), t.TempDir(), Options{}, files.Patterns{}, tc.command)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			file, ok := outputs[tc.command.StderrFileName]
+			if !ok {
+				t.Fatalf("expected %s to be captured", tc.command.StderrFileName)
+			}
+
+			var actual interface{}
+			if tc.command.StderrHasJsonOutput {
+				if actual, ok = file.Json(); !ok {
+					t.Fatalf("expected %s to be a JSON file", tc.command.StderrFileName)
+				}
+			} else {
+				if actual, ok = file.String(); !ok {
+					t.Fatalf("expected %s to be a raw file", tc.command.StderrFileName)
+				}
+			}
+			if diff := cmp.Diff(tc.expected, actual); len(diff) > 0 {
+				t.Errorf("unexpected stderr:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExecuteTestStderrInvalidJson(t *testing.T) {
+	tf := fakeBinary(t, `echo "not json" >&2`)
+
+	_, err := tf.ExecuteTest(context.Background(), t.TempDir(), Options{}, files.Patterns{}, Command{
+		Name:                "validate",
+		StderrFileName:      "validate.stderr.json",
+		StderrHasJsonOutput: true,
+	})
+	if err == nil {
+		t.Fatalf("expected an error but found none")
+	}
+	if !strings.Contains(err.Error(), "could not parse stderr of command (validate)") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestExecuteTestTimeout(t *testing.T) {
+	// Each attempt records itself before hanging, so we can count them.
+	tf := fakeBinary(t, `echo "attempt" >> attempts; echo "partial"; sleep 30`)
+	directory := t.TempDir()
+
+	started := time.Now()
+	_, err := tf.ExecuteTest(context.Background(), directory, Options{}, files.Patterns{}, Command{
+		Name:    "hang",
+		Timeout: Duration(200 * time.Millisecond),
+		Retries: 2,
+	})
+	if err == nil {
+		t.Fatalf("expected an error but found none")
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("expected the command to be killed, but it took %s", elapsed)
+	}
+
+	var binaryErr Error
+	if !errors.As(err, &binaryErr) {
+		t.Fatalf("expected a binary.Error, found %T", err)
+	}
+	if !binaryErr.TimedOut {
+		t.Errorf("expected the command to time out: %v", err)
+	}
+	if binaryErr.Output != "partial\n" {
+		t.Errorf("expected the partial output to be kept, found %q", binaryErr.Output)
+	}
+	if expected := "the command reached its 200ms timeout"; binaryErr.Go.Error() != expected {
+		t.Errorf("expected reason %q, found %q", expected, binaryErr.Go)
+	}
+
+	attempts, err := os.ReadFile(path.Join(directory, "attempts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.Count(string(attempts), "attempt"); count != 3 {
+		t.Errorf("expected 3 attempts, found %d", count)
+	}
+}
+
+func TestExecuteTestDeadline(t *testing.T) {
+	tf := fakeBinary(t, `sleep 30`)
+
+	_, err := tf.ExecuteTest(context.Background(), t.TempDir(), Options{Deadline: time.Now().Add(200 * time.Millisecond)}, files.Patterns{}, Command{
+		Name:    "hang",
+		Timeout: Duration(time.Minute),
+		Retries: 1,
+	})
+
+	var binaryErr Error
+	if !errors.As(err, &binaryErr) {
+		t.Fatalf("expected a binary.Error, found %v", err)
+	}
+	if !binaryErr.TimedOut {
+		t.Errorf("expected the command to time out: %v", err)
+	}
+
+	// The retry starts after the deadline has passed, so it never runs.
+	if expected := "the test ran out of time before the command started"; binaryErr.Go.Error() != expected {
+		t.Errorf("expected reason %q, found %q", expected, binaryErr.Go)
+	}
+}
+
+func TestExecuteTestInterruptEscalates(t *testing.T) {
+	defer func(period time.Duration) {
+		interruptGracePeriod = period
+	}(interruptGracePeriod)
+	interruptGracePeriod = 200 * time.Millisecond
+
+	// The command ignores the interrupt, so it has to be killed once the
+	// grace period is over.
+	tf := fakeBinary(t, `trap '' INT; sleep 30`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	started := time.Now()
+	_, err := tf.ExecuteTest(ctx, t.TempDir(), Options{}, files.Patterns{}, Command{Name: "hang"})
+	elapsed := time.Since(started)
+	if elapsed < 400*time.Millisecond {
+		t.Errorf("expected the command to outlast the grace period, but it took %s", elapsed)
+	}
+	if elapsed > 10*time.Second {
+		t.Errorf("expected the command to be killed, but it took %s", elapsed)
+	}
+
+	var binaryErr Error
+	if !errors.As(err, &binaryErr) {
+		t.Fatalf("expected a binary.Error, found %v", err)
+	}
+	if !binaryErr.Cancelled {
+		t.Errorf("expected the command to be cancelled: %v", err)
+	}
+}
+
+// childScript starts a child process that outlives an interrupt, as commands
+// started in the background by sh ignore SIGINT, and records its pid.
+const childScript = `sleep 30 & echo $! > child; wait`
+
+// waitForChild waits for the child started by childScript to record its pid.
+func waitForChild(t *testing.T, directory string) int {
+	t.Helper()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		data, err := os.ReadFile(path.Join(directory, "child"))
+		if err != nil || !strings.HasSuffix(string(data), "\n") {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pid
+	}
+	t.Fatalf("the child process never started")
+	return 0
+}
+
+// checkStopped fails the test if the process with pid is still running. A
+// process that has exited but not been reaped yet counts as stopped.
+func checkStopped(t *testing.T, pid int) {
+	t.Helper()
+
+	for start := time.Now(); time.Since(start) < 2*time.Second; time.Sleep(10 * time.Millisecond) {
+		if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+			return
+		}
+		if stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil && strings.Contains(string(stat), ") Z ") {
+			return
+		}
+	}
+	t.Errorf("process %d is still running", pid)
+}
+
+func TestExecuteTestCancelled(t *testing.T) {
+	defer func(period time.Duration) {
+		interruptGracePeriod = period
+	}(interruptGracePeriod)
+	interruptGracePeriod = 200 * time.Millisecond
+
+	tf := fakeBinary(t, childScript)
+	directory := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := tf.ExecuteTest(ctx, directory, Options{}, files.Patterns{}, Command{Name: "hang"})
+		errs <- err
+	}()
+
+	child := waitForChild(t, directory)
+	cancel()
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the command was never stopped")
+	}
+
+	var binaryErr Error
+	if !errors.As(err, &binaryErr) {
+		t.Fatalf("expected a binary.Error, found %v", err)
+	}
+	if !binaryErr.Cancelled {
+		t.Errorf("expected the command to be cancelled: %v", err)
+	}
+	checkStopped(t, child)
+}
+
+func TestKillRunning(t *testing.T) {
+	defer func() {
+		running.Lock()
+		defer running.Unlock()
+		running.killed = false
+	}()
+
+	tf := fakeBinary(t, childScript)
+	directory := t.TempDir()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := tf.ExecuteTest(context.Background(), directory, Options{}, files.Patterns{}, Command{Name: "hang"})
+		errs <- err
+	}()
+
+	child := waitForChild(t, directory)
+	KillRunning()
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Errorf("expected the killed command to fail")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the command was never stopped")
+	}
+	checkStopped(t, child)
+
+	// Commands that start afterwards are killed as well.
+	started := time.Now()
+	if _, err := tf.ExecuteTest(context.Background(), t.TempDir(), Options{}, files.Patterns{}, Command{Name: "hang"}); err == nil {
+		t.Errorf("expected a command started after KillRunning to fail")
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("expected the command to be killed, but it took %s", elapsed)
+	}
+}
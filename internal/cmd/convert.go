@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/cli"
+
+	"github.com/opentofu/equivalence-testing/internal/tests"
+)
+
+func ConvertCommandFactory(ui cli.Ui) cli.CommandFactory {
+	return func() (cli.Command, error) {
+		return &convertCommand{
+			ui: ui,
+		}, nil
+	}
+}
+
+type convertCommand struct {
+	ui cli.Ui
+}
+
+func (cmd *convertCommand) Help() string {
+	return strings.TrimSpace(`
+Usage: equivalence-testing convert [--write] examples/example_test_cases/simple_resource/spec.json
+
+Convert a test specification between the JSON and HCL formats.
+
+A .json file is converted into HCL, and a .hcl file is converted into JSON. By default, the converted specification is printed. If --write is set, the converted specification is written next to the original file, and the original file is deleted.
+
+Note, that any comments in the original file are not converted.`)
+}
+
+func (cmd *convertCommand) Run(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+
+	var write bool
+	fs.BoolVar(&write, "write", false, "Write the converted specification next to the original file, and delete the original file.")
+
+	if err := fs.Parse(args); err != nil {
+		cmd.ui.Error(err.Error())
+		return 1
+	}
+
+	if len(fs.Args()) != 1 {
+		cmd.ui.Error("convert expects exactly one specification file")
+		return 1
+	}
+	source := fs.Args()[0]
+
+	specification, err := tests.ReadSpecification(source)
+	if err != nil {
+		cmd.ui.Error(err.Error())
+		return 1
+	}
+
+	var data []byte
+	var ext string
+	switch filepath.Ext(source) {
+	case ".hcl":
+		ext = ".json"
+		// We don't escape HTML characters, so constraints like ">= 1.6.0" and
+		// conditions using && stay readable.
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(specification); err != nil {
+			cmd.ui.Error(err.Error())
+			return 1
+		}
+		data = buffer.Bytes()
+	default:
+		ext = ".hcl"
+		if data, err = tests.WriteHCLSpecification(specification); err != nil {
+			cmd.ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	if !write {
+		cmd.ui.Output(strings.TrimSpace(string(data)))
+		return 0
+	}
+
+	target := strings.TrimSuffix(source, filepath.Ext(source)) + ext
+	if err := os.WriteFile(target, data, os.ModePerm); err != nil {
+		cmd.ui.Error(err.Error())
+		return 1
+	}
+	if err := os.Remove(source); err != nil {
+		cmd.ui.Error(err.Error())
+		return 1
+	}
+
+	cmd.ui.Output(fmt.Sprintf("Converted %s into %s", source, target))
+	return 0
+}
+
+func (cmd *convertCommand) Synopsis() string {
+	return "Convert a test specification between the JSON and HCL formats."
+}
@@ -9,6 +9,9 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"time"
+
+	"github.com/opentofu/equivalence-testing/internal/tests"
 )
 
 // Flags is a helpful struct that contains the global flags for the equivalence
@@ -25,16 +28,65 @@ type Flags struct {
 	// The relative or absolute path to the target binary.
 	BinaryPath string
 
+	// The flavor of the target binary, used to select golden file variants.
+	// If empty, the file name of the binary is used.
+	Flavor string
+
 	// If empty, then all tests will be executed. If not empty, only tests
 	// included in this flag will be executed.
 	TestFilters StringList
 
+	// If not empty, only tests with at least one of these tags will be
+	// executed.
+	Tags StringList
+
+	// If not empty, tests with any of these tags will not be executed.
+	ExcludeTags StringList
+
+	// If not empty, only tests with names matching at least one of these
+	// patterns will be executed.
+	Match StringList
+
+	// If not empty, tests with names matching any of these patterns will not
+	// be executed.
+	Exclude StringList
+
 	// The relative or absolute path to the JSONC file containing global
 	// rewrites. This can be empty, in which case there are no global rewrites.
 	RewritesPath string
 
 	// How many instances of the binary to run in parallel
 	Parallel int
+
+	// The maximum number of changes to print for a single file, and for the
+	// whole run. Zero means there is no limit.
+	DiffLimit    int
+	DiffRunLimit int
+
+	// The relative or absolute path to a directory that the full diffs should
+	// be written into. This can be empty, in which case the full diffs are not
+	// saved.
+	ArtifactsDirectory string
+
+	// If true, every test is executed with an isolated environment regardless
+	// of the setting in its specification.
+	IsolateEnv bool
+
+	// Additional host environment variables that are passed to the binary
+	// when the environment is isolated.
+	AllowEnv StringList
+
+	// The maximum time each test can take, unless the test specification sets
+	// its own timeout. Zero means there is no limit.
+	Timeout time.Duration
+
+	// If true, the resolved specification for each test is printed before the
+	// test is executed.
+	Verbose bool
+
+	// If true, any ignore_fields or rewrites that matched nothing in the
+	// outputs of a test fail the run.
+	StrictRules bool
 }
 
 func ParseFlags(command string, args []string) (*Flags, error) {
@@ -45,9 +97,22 @@ func ParseFlags(command string, args []string) (*Flags, error) {
 	fs.StringVar(&flags.GoldenFilesDirectory, "goldens", "", "Absolute or relative path to the directory containing the golden files.")
 	fs.StringVar(&flags.TestingFilesDirectory, "tests", "", "Absolute or relative path to the directory containing the tests and specifications.")
 	fs.StringVar(&flags.BinaryPath, "binary", "opentf", "Absolute or relative path to the target binary.")
+	fs.StringVar(&flags.Flavor, "flavor", "", "The flavor of the target binary, used to select golden file variants. Defaults to the file name of the binary.")
 	fs.StringVar(&flags.RewritesPath, "rewrites", "", "Absolute or relative path to the JSONC file containing global rewrites.")
 	fs.Var(&flags.TestFilters, "filters", "If specified, only test cases included in this list will be executed.")
+	fs.Var(&flags.Tags, "tags", "If specified, only test cases with at least one of these tags will be executed.")
+	fs.Var(&flags.ExcludeTags, "exclude-tags", "If specified, test cases with any of these tags will not be executed.")
+	fs.Var(&flags.Match, "match", "If specified, only test cases with names matching one of these glob patterns, or /regular expressions/, will be executed.")
+	fs.Var(&flags.Exclude, "exclude", "If specified, test cases with names matching any of these glob patterns, or /regular expressions/, will not be executed.")
 	fs.IntVar(&flags.Parallel, "parallel", 1, "How many instances of the binary to run in parallel")
+	fs.IntVar(&flags.DiffLimit, "diff-limit", 50, "The maximum number of changes to print for each file, 0 means no limit.")
+	fs.IntVar(&flags.DiffRunLimit, "diff-run-limit", 500, "The maximum number of changes to print across all tests, 0 means no limit.")
+	fs.BoolVar(&flags.IsolateEnv, "isolate-env", false, "Execute every test with an isolated environment.")
+	fs.Var(&flags.AllowEnv, "allow-env", "Additional host environment variables to pass to the binary when the environment is isolated.")
+	fs.DurationVar(&flags.Timeout, "timeout", 0, "The maximum time each test can take, eg. 10m, unless the test specification sets its own timeout.")
+	fs.BoolVar(&flags.Verbose, "verbose", false, "Print the resolved specification for each test before executing it.")
+	fs.BoolVar(&flags.StrictRules, "strict-rules", false, "Fail the run if any ignore_fields or rewrites matched nothing in the outputs of a test.")
+	fs.StringVar(&flags.ArtifactsDirectory, "artifacts", "", "Absolute or relative path to the directory the full diffs should be written into.")
 
 	if err := fs.Parse(args); err != nil {
 		return nil, err
@@ -74,3 +139,14 @@ func ParseFlags(command string, args []string) (*Flags, error) {
 
 	return &flags, nil
 }
+
+// Selector returns the tests.Selector described by the test selection flags.
+func (flags Flags) Selector() tests.Selector {
+	return tests.Selector{
+		Names:       flags.TestFilters,
+		Tags:        flags.Tags,
+		ExcludeTags: flags.ExcludeTags,
+		Match:       flags.Match,
+		Exclude:     flags.Exclude,
+	}
+}
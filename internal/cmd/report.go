@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/opentofu/equivalence-testing/internal/tests"
+)
+
+// diffPrinter renders the differences found for each test case while making
+// sure very large diffs don't flood the console.
+//
+// At most fileLimit changes are printed for a single file, and at most
+// runLimit changes are printed across the whole run. Any changes that are cut
+// are summarised instead. If an artifacts directory is set, the full diff for
+// each changed file is written into it.
+//
+// A single diffPrinter is shared between all the tests running in parallel.
+type diffPrinter struct {
+	fileLimit int
+	runLimit  int
+	artifacts string
+
+	mutex   sync.Mutex
+	printed int
+}
+
+// Render returns the diff for a single test case as a string ready to be
+// printed to the console.
+func (printer *diffPrinter) Render(test string, diffs map[string]tests.FileDiff) (string, error) {
+	var names []string
+	for name := range diffs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	for _, name := range names {
+		diff := diffs[name]
+		if len(diff.Status) > 0 {
+			builder.WriteString(fmt.Sprintf("[%s]: %s %s\n", test, name, diff.Status))
+			continue
+		}
+
+		builder.WriteString(fmt.Sprintf("[%s]: %s has %d change(s)\n", test, name, len(diff.Changes)))
+
+		shown := printer.reserve(len(diff.Changes))
+		for _, change := range diff.Changes[:shown] {
+			builder.WriteString(change.String())
+		}
+
+		if remaining := diff.Changes[shown:]; len(remaining) > 0 {
+			if common := tests.CommonPath(remaining); len(common) > 0 {
+				builder.WriteString(fmt.Sprintf("...and %d more change(s) under %s\n", len(remaining), common))
+			} else {
+				builder.WriteString(fmt.Sprintf("...and %d more change(s)\n", len(remaining)))
+			}
+		}
+
+		if len(printer.artifacts) > 0 {
+			target, err := printer.writeArtifact(test, name, diff)
+			if err != nil {
+				return "", err
+			}
+			builder.WriteString(fmt.Sprintf("full diff written to %s\n", target))
+		}
+	}
+	return builder.String(), nil
+}
+
+// reserve returns how many out of the requested changes can still be printed
+// for a single file, and records them against the limit for the whole run.
+func (printer *diffPrinter) reserve(changes int) int {
+	printer.mutex.Lock()
+	defer printer.mutex.Unlock()
+
+	allowed := changes
+	if printer.fileLimit > 0 && allowed > printer.fileLimit {
+		allowed = printer.fileLimit
+	}
+	if printer.runLimit > 0 {
+		if left := printer.runLimit - printer.printed; allowed > left {
+			allowed = left
+		}
+		if allowed < 0 {
+			allowed = 0
+		}
+	}
+
+	printer.printed += allowed
+	return allowed
+}
+
+func (printer *diffPrinter) writeArtifact(test, name string, diff tests.FileDiff) (string, error) {
+	target := path.Join(printer.artifacts, test, name+".diff")
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(target, []byte(diff.Diff), os.ModePerm); err != nil {
+		return "", err
+	}
+	return target, nil
+}
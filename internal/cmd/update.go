@@ -5,10 +5,15 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"path"
 	"strings"
 	"sync"
+	"syscall"
 
 	"github.com/komkom/jsonc/jsonc"
 	"github.com/mitchellh/cli"
@@ -31,13 +36,15 @@ type updateCommand struct {
 
 func (cmd *updateCommand) Help() string {
 	return strings.TrimSpace(`
-Usage: equivalence-testing update --goldens=examples/example_golden_files --tests=examples/example_test_cases [--binary=opentf] [--filters=complex_resource,simple_resource]
+Usage: equivalence-testing update --goldens=examples/example_golden_files --tests=examples/example_test_cases [--binary=opentf] [--flavor=tofu] [--filters=complex_resource,simple_resource] [--tags=smoke] [--exclude-tags=slow] [--match=complex_*] [--exclude=/_slow$/] [--diff-limit=50] [--diff-run-limit=500] [--artifacts=diffs] [--isolate-env] [--allow-env=AWS_PROFILE] [--timeout=10m] [--verbose] [--strict-rules]
 
 Update the equivalence test golden files.
 
 This command will execute all the test cases within the tests directory, and write the outputs into the specified golden files directory. This will overwrite any existing golden files.
 
-Note, that this command won't report any differences it finds. It will only update the golden files.`)
+Before overwriting the golden files this command prints the differences it found, and checks the assertions from the test specifications. Failing assertions don't stop the golden files being updated, but the command exits with an error. Use --diff-limit and --diff-run-limit to control how much of each diff is printed, and --artifacts to write the full diffs into a directory.
+
+Interrupting the command (eg. with Ctrl-C) stops any new tests from starting, and interrupts the binary for any running tests. Golden files are not updated for tests that are interrupted. Interrupt a second time to kill the binary for any running tests immediately, instead of waiting for them to exit.`)
 }
 
 func (cmd *updateCommand) Run(args []string) int {
@@ -47,14 +54,14 @@ func (cmd *updateCommand) Run(args []string) int {
 		return 1
 	}
 
-	tf, err := binary.New(flags.BinaryPath)
+	tf, err := binary.New(flags.BinaryPath, flags.Flavor)
 	if err != nil {
 		cmd.ui.Error(err.Error())
 		return 1
 	}
-	cmd.ui.Output(fmt.Sprintf("Updating golden files using the binary v%s with command `%s`", tf.Version(), flags.BinaryPath))
+	cmd.ui.Output(fmt.Sprintf("Updating golden files using the %s binary v%s with command `%s`", tf.Flavor(), tf.Version(), flags.BinaryPath))
 
-	globalRewrites := make(map[string]map[string]string)
+	globalRewrites := make(map[string]tests.Rewrites)
 
 	if len(flags.RewritesPath) > 0 {
 		data, err := os.ReadFile(flags.RewritesPath)
@@ -76,15 +83,84 @@ func (cmd *updateCommand) Run(args []string) int {
 
 	}
 
-	testCases, err := tests.ReadFrom(flags.TestingFilesDirectory, globalRewrites, flags.TestFilters...)
+	testCases, err := tests.ReadFrom(flags.TestingFilesDirectory, globalRewrites, flags.Selector())
 	if err != nil {
 		cmd.ui.Error(err.Error())
 		return 1
 	}
-	cmd.ui.Output(fmt.Sprintf("Found %d test cases in %s\n", len(testCases), flags.TestingFilesDirectory))
+	cmd.ui.Output(fmt.Sprintf("Found %d test cases in %s", len(testCases), flags.TestingFilesDirectory))
+	for _, test := range testCases {
+		cmd.ui.Output(fmt.Sprintf("\t%s", test.Name))
+	}
+	cmd.ui.Output("")
+
+	for ix := range testCases {
+		if flags.IsolateEnv {
+			testCases[ix].Specification.IsolateEnv = true
+		}
+		testCases[ix].Specification.AllowEnv = append(testCases[ix].Specification.AllowEnv, flags.AllowEnv...)
+		if testCases[ix].Specification.Timeout == 0 {
+			testCases[ix].Specification.Timeout = binary.Duration(flags.Timeout)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	go func() {
+		select {
+		case <-interrupts:
+			cmd.ui.Output("Interrupted, stopping the running tests. Interrupt again to stop them immediately.")
+			cancel()
+		case <-stopped:
+			return
+		}
+
+		// We keep handling the signals after the first interrupt, instead of
+		// letting a second interrupt exit immediately. Otherwise, the binaries
+		// in their own process groups would keep running and the temporary
+		// directories of the tests would never be removed.
+		select {
+		case <-interrupts:
+			cmd.ui.Output("Interrupted again, killing the running tests.")
+			binary.KillRunning()
+		case <-stopped:
+		}
+	}()
 
 	successfulTests := 0
 	failedTests := 0
+	skippedTests := 0
+	cancelledTests := 0
+	startedTests := 0
+	failedAssertions := 0
+	unusedRules := 0
+
+	// globalHits counts the matches for the global rewrites across every
+	// test.
+	globalHits := tests.GlobalRewriteHits{}
+
+	// The counters and globalHits are updated by the goroutines running the
+	// tests, so they must hold the mutex while doing so.
+	var mutex sync.Mutex
+	count := func(counter *int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		*counter++
+	}
+
+	printer := &diffPrinter{
+		fileLimit: flags.DiffLimit,
+		runLimit:  flags.DiffRunLimit,
+		artifacts: flags.ArtifactsDirectory,
+	}
 
 	var wg sync.WaitGroup
 	running := make(chan interface{}, flags.Parallel)
@@ -92,19 +168,56 @@ func (cmd *updateCommand) Run(args []string) int {
 	for _, test := range testCases {
 		test := test
 
+		select {
+		case running <- nil:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			// Then we were interrupted, so we don't start any more tests.
+			break
+		}
+
+		startedTests++
 		wg.Add(1)
-		running <- nil
 		go func() {
 			defer func() {
 				<-running
 				wg.Done()
 			}()
 
+			supported, err := test.Specification.SupportsVersion(tf.Version())
+			if err != nil {
+				count(&failedTests)
+				cmd.ui.Output(fmt.Sprintf("[%s]: unknown error (%v)", test.Name, err))
+				return
+			}
+			if !supported {
+				count(&skippedTests)
+				cmd.ui.Output(fmt.Sprintf("[%s]: skipped, requires version %s\n", test.Name, test.Specification.RequiresVersion))
+				return
+			}
+
 			cmd.ui.Output(fmt.Sprintf("[%s]: starting...", test.Name))
 
-			output, err := test.RunWith(tf)
+			if flags.Verbose {
+				specification, err := json.MarshalIndent(test.Specification, "", "  ")
+				if err != nil {
+					count(&failedTests)
+					cmd.ui.Output(fmt.Sprintf("[%s]: unknown error (%v)", test.Name, err))
+					return
+				}
+				cmd.ui.Output(fmt.Sprintf("[%s]: resolved specification:\n%s", test.Name, specification))
+			}
+
+			output, err := test.RunWith(ctx, tf)
 			if err != nil {
-				failedTests++
+				if ctx.Err() != nil {
+					count(&cancelledTests)
+					cmd.ui.Output(fmt.Sprintf("[%s]: cancelled", test.Name))
+					return
+				}
+
+				count(&failedTests)
 				if tfErr, ok := err.(binary.Error); ok {
 					cmd.ui.Output(fmt.Sprintf("[%s]: %s", test.Name, tfErr))
 					return
@@ -113,32 +226,145 @@ func (cmd *updateCommand) Run(args []string) int {
 				return
 			}
 
+			directory, err := output.GoldenDirectory(flags.GoldenFilesDirectory)
+			if err != nil {
+				count(&failedTests)
+				cmd.ui.Output(fmt.Sprintf("[%s]: unknown error (%v)", test.Name, err))
+				return
+			}
+			if variant := path.Base(directory); strings.HasPrefix(variant, tests.VariantPrefix) {
+				cmd.ui.Output(fmt.Sprintf("[%s]: using golden variant %s", test.Name, variant))
+			}
+
+			diffs, err := output.ComputeDiff(flags.GoldenFilesDirectory)
+			if err != nil {
+				count(&failedTests)
+				cmd.ui.Output(fmt.Sprintf("[%s]: unknown error (%v)", test.Name, err))
+				return
+			}
+
+			warnings, err := output.Warnings()
+			if err != nil {
+				count(&failedTests)
+				cmd.ui.Output(fmt.Sprintf("[%s]: unknown error (%v)", test.Name, err))
+				return
+			}
+			for _, warning := range warnings {
+				cmd.ui.Output(fmt.Sprintf("[%s]: warning: %s", test.Name, warning))
+			}
+
+			unused, hits, err := output.UnusedRules()
+			if err != nil {
+				count(&failedTests)
+				cmd.ui.Output(fmt.Sprintf("[%s]: unknown error (%v)", test.Name, err))
+				return
+			}
+			mutex.Lock()
+			globalHits.Add(hits)
+			mutex.Unlock()
+			for _, rule := range unused {
+				cmd.ui.Output(fmt.Sprintf("[%s]: unused rule: %s", test.Name, rule))
+			}
+			if len(unused) > 0 {
+				count(&unusedRules)
+			}
+
+			report, err := printer.Render(test.Name, diffs)
+			if err != nil {
+				count(&failedTests)
+				cmd.ui.Output(fmt.Sprintf("[%s]: unknown error (%v)", test.Name, err))
+				return
+			}
+			cmd.ui.Output(strings.TrimSpace(report))
+
+			// Assertions are reported separately from the golden files, a test
+			// with failing assertions still has its golden files updated.
+			failures, err := output.CheckAssertions()
+			if err != nil {
+				count(&failedTests)
+				cmd.ui.Output(fmt.Sprintf("[%s]: unknown error (%v)", test.Name, err))
+				return
+			}
+			for _, failure := range failures {
+				cmd.ui.Output(fmt.Sprintf("[%s]: assertion failed: %s", test.Name, failure))
+			}
+			if len(failures) > 0 {
+				count(&failedAssertions)
+			}
+
+			if ctx.Err() != nil {
+				// We don't start writing the golden files once we've been
+				// interrupted, so they are never left half updated.
+				count(&cancelledTests)
+				cmd.ui.Output(fmt.Sprintf("[%s]: cancelled before updating golden files", test.Name))
+				return
+			}
+
 			cmd.ui.Output(fmt.Sprintf("[%s]: updating golden files...", test.Name))
 
 			if err := output.UpdateGoldenFiles(flags.GoldenFilesDirectory); err != nil {
-				failedTests++
+				count(&failedTests)
 				cmd.ui.Output(fmt.Sprintf("[%s]: unknown error (%v)", test.Name, err))
 				return
 			}
 
-			successfulTests++
+			count(&successfulTests)
 			cmd.ui.Output(fmt.Sprintf("[%s]: complete\n", test.Name))
 		}()
 	}
 
 	wg.Wait()
 
-	cmd.ui.Output("Equivalence testing complete.")
-	cmd.ui.Output(fmt.Sprintf("\tAttempted %d test(s).", len(testCases)))
+	interrupted := ctx.Err() != nil
+
+	// The global rewrites are only checked once every test has been run, as
+	// a global rewrite only needs to match the outputs of one test. If any
+	// test didn't get that far, we can't tell whether it would have matched.
+	var unusedGlobalRules []string
+	if !interrupted && failedTests == 0 {
+		unusedGlobalRules = globalHits.Unused(globalRewrites)
+		for _, rule := range unusedGlobalRules {
+			cmd.ui.Output(fmt.Sprintf("unused rule: %s", rule))
+		}
+	}
+	if interrupted {
+		cmd.ui.Output("Equivalence testing interrupted.")
+	} else {
+		cmd.ui.Output("Equivalence testing complete.")
+	}
+	cmd.ui.Output(fmt.Sprintf("\tAttempted %d test(s).", startedTests))
 
 	if successfulTests > 0 {
 		cmd.ui.Output(fmt.Sprintf("\t%d test(s) were successfully updated.", successfulTests))
 	}
+	if skippedTests > 0 {
+		cmd.ui.Output(fmt.Sprintf("\t%d test(s) were skipped.", skippedTests))
+	}
 	if failedTests > 0 {
 		cmd.ui.Output(fmt.Sprintf("\t%d test(s) failed to update.", failedTests))
-		return 1
+	}
+	if cancelledTests > 0 {
+		cmd.ui.Output(fmt.Sprintf("\t%d test(s) were cancelled.", cancelledTests))
+	}
+	if notStarted := len(testCases) - startedTests; notStarted > 0 {
+		cmd.ui.Output(fmt.Sprintf("\t%d test(s) were not started.", notStarted))
+	}
+	if failedAssertions > 0 {
+		cmd.ui.Output(fmt.Sprintf("\t%d test(s) had failing assertions.", failedAssertions))
+	}
+	if unusedRules > 0 {
+		cmd.ui.Output(fmt.Sprintf("\t%d test(s) had rules that matched nothing.", unusedRules))
+	}
+	if len(unusedGlobalRules) > 0 {
+		cmd.ui.Output(fmt.Sprintf("\t%d global rewrite(s) matched nothing in any test.", len(unusedGlobalRules)))
 	}
 
+	if interrupted || failedTests > 0 || failedAssertions > 0 {
+		return 1
+	}
+	if flags.StrictRules && (unusedRules > 0 || len(unusedGlobalRules) > 0) {
+		return 1
+	}
 	return 0
 }
 
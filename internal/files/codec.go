@@ -0,0 +1,237 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package files
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RawCodec is the name used to read a file as plain text, instead of decoding
+// it with a codec.
+const RawCodec = "raw"
+
+// Codec converts a file between its contents and a tree of values.
+//
+// The tree uses the same types as encoding/json uses when decoding into an
+// interface{}, so the trees of every codec can be stripped, compared and
+// written in the same way as JSON files.
+type Codec interface {
+	// Name is used to select the codec from a test specification.
+	Name() string
+
+	Decode(contents []byte) (interface{}, error)
+	Encode(data interface{}) ([]byte, error)
+}
+
+var (
+	codecs = map[string]Codec{}
+
+	// extensions maps file extensions, including the leading dot, to the
+	// name of the codec that reads them by default.
+	extensions = map[string]string{}
+)
+
+func init() {
+	RegisterCodec(jsonCodec{}, ".json")
+	RegisterCodec(ndjsonCodec{}, ".ndjson", ".jsonl")
+	RegisterCodec(yamlCodec{}, ".yaml", ".yml")
+	RegisterCodec(hclCodec{}, ".hcl")
+}
+
+// RegisterCodec adds a codec to the registry, and makes it the default codec
+// for files with any of the given extensions.
+func RegisterCodec(codec Codec, exts ...string) {
+	codecs[codec.Name()] = codec
+	for _, ext := range exts {
+		extensions[ext] = codec.Name()
+	}
+}
+
+// LookupCodec returns the registered codec with the given name.
+func LookupCodec(name string) (Codec, bool) {
+	codec, ok := codecs[name]
+	return codec, ok
+}
+
+// CodecNames returns the names of every registered codec, and RawCodec, in
+// sorted order.
+func CodecNames() []string {
+	names := []string{RawCodec}
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CodecOverrides maps file names or glob patterns, using the syntax of
+// path.Match, to the name of the codec that should read the matching files
+// instead of the codec chosen by their extension.
+type CodecOverrides map[string]string
+
+// Validate returns an error if any of the patterns are malformed, or any of
+// the codecs don't exist.
+func (o CodecOverrides) Validate() error {
+	var patterns []string
+	for pattern := range o {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("codec for %s: invalid file pattern: %w", pattern, err)
+		}
+
+		if name := o[pattern]; name != RawCodec {
+			if _, ok := codecs[name]; !ok {
+				return fmt.Errorf("codec for %s: unrecognized codec %q, expected one of %s", pattern, name, strings.Join(CodecNames(), ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// codecName returns the name of the codec that should read file. An exact
+// match for the file name is preferred, otherwise the first matching pattern
+// in sorted order is used.
+func (o CodecOverrides) codecName(file string) (string, bool) {
+	file = filepath.ToSlash(file)
+	if name, ok := o[file]; ok {
+		return name, true
+	}
+
+	var patterns []string
+	for pattern := range o {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, file); matched {
+			return o[pattern], true
+		}
+	}
+	return "", false
+}
+
+// NewFile returns a File for the contents of file, decoded with the codec
+// that overrides the file or the codec for its extension. Files without a
+// codec are read as plain text.
+func (o CodecOverrides) NewFile(file string, contents []byte) (*File, error) {
+	name, ok := o.codecName(file)
+	if !ok {
+		name, ok = extensions[filepath.Ext(file)]
+	}
+	if !ok || name == RawCodec {
+		return NewRawFile(string(contents)), nil
+	}
+
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized codec %q", name)
+	}
+
+	data, codec, err := decode(codec, contents)
+	if err != nil {
+		return nil, err
+	}
+	return NewStructuredFile(codec, data), nil
+}
+
+// fileDecoder is implemented by codecs that need to remember details of the
+// contents they decoded that aren't kept in the tree of values, so the tree
+// can be written back in the same form.
+type fileDecoder interface {
+	// decodeFile is the same as Decode, but also returns the codec that
+	// should write the tree.
+	decodeFile(contents []byte) (interface{}, Codec, error)
+}
+
+// decode decodes contents with codec, and returns the codec that should write
+// the tree.
+func decode(codec Codec, contents []byte) (interface{}, Codec, error) {
+	if decoder, ok := codec.(fileDecoder); ok {
+		return decoder.decodeFile(contents)
+	}
+
+	data, err := codec.Decode(contents)
+	return data, codec, err
+}
+
+// jsonCodec reads and writes JSON files, with two spaces of indentation.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Decode(contents []byte) (interface{}, error) {
+	var data interface{}
+	if err := json.Unmarshal(contents, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (jsonCodec) Encode(data interface{}) ([]byte, error) {
+	// We don't escape HTML characters, so placeholders such as
+	// <masked:string> are written into the golden files as they are.
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// ndjsonCodec reads and writes files that contain a JSON value on each line.
+// The tree is a list with an entry for each line, and blank lines are
+// ignored.
+type ndjsonCodec struct{}
+
+func (ndjsonCodec) Name() string {
+	return "ndjson"
+}
+
+func (ndjsonCodec) Decode(contents []byte) (interface{}, error) {
+	lines := []interface{}{}
+	for ix, line := range bytes.Split(contents, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var data interface{}
+		if err := json.Unmarshal(line, &data); err != nil {
+			return nil, fmt.Errorf("line %d: %w", ix+1, err)
+		}
+		lines = append(lines, data)
+	}
+	return lines, nil
+}
+
+func (ndjsonCodec) Encode(data interface{}) ([]byte, error) {
+	lines, ok := data.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("ndjson files must contain a list, found %T", data)
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	for _, line := range lines {
+		if err := encoder.Encode(line); err != nil {
+			return nil, err
+		}
+	}
+	return buffer.Bytes(), nil
+}
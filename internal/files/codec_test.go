@@ -0,0 +1,239 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package files
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCodecs(t *testing.T) {
+	tcs := map[string]struct {
+		codec    string
+		input    string
+		expected interface{}
+		output   string
+	}{
+		"json": {
+			codec:    "json",
+			input:    `{"b": [1, "<a>"], "a": null}`,
+			expected: map[string]interface{}{"a": nil, "b": []interface{}{float64(1), "<a>"}},
+			output:   "{\n  \"a\": null,\n  \"b\": [\n    1,\n    \"<a>\"\n  ]\n}",
+		},
+		"ndjson": {
+			codec: "ndjson",
+			input: "{\"@level\": \"info\"}\n\n[1, 2]\n",
+			expected: []interface{}{
+				map[string]interface{}{"@level": "info"},
+				[]interface{}{float64(1), float64(2)},
+			},
+			output: "{\"@level\":\"info\"}\n[1,2]\n",
+		},
+		"yaml": {
+			codec: "yaml",
+			input: "name: test\ncount: 2\nenabled: true\nwhen: 2024-01-02T03:04:05Z\nitems:\n  - a\n  - 1.5\n1: one\n",
+			expected: map[string]interface{}{
+				"name":    "test",
+				"count":   float64(2),
+				"enabled": true,
+				"when":    "2024-01-02T03:04:05Z",
+				"items":   []interface{}{"a", 1.5},
+				"1":       "one",
+			},
+			output: "\"1\": one\ncount: 2\nenabled: true\nitems:\n  - a\n  - 1.5\nname: test\nwhen: \"2024-01-02T03:04:05Z\"\n",
+		},
+		"yaml empty": {
+			codec:    "yaml",
+			input:    "",
+			expected: nil,
+			output:   "null\n",
+		},
+		"hcl": {
+			codec: "hcl",
+			input: `
+resource "null_resource" "a" {
+  triggers = { id = "x" }
+}
+
+resource "null_resource" "b" {
+  count = 2
+}
+
+locals {
+  name = "${var.prefix}-b"
+  list = [1, 2]
+}
+`,
+			expected: map[string]interface{}{
+				"resource": map[string]interface{}{
+					"null_resource": map[string]interface{}{
+						"a": []interface{}{
+							map[string]interface{}{"triggers": map[string]interface{}{"id": "x"}},
+						},
+						"b": []interface{}{
+							map[string]interface{}{"count": float64(2)},
+						},
+					},
+				},
+				"locals": []interface{}{
+					map[string]interface{}{
+						"name": `${"${var.prefix}-b"}`,
+						"list": []interface{}{float64(1), float64(2)},
+					},
+				},
+			},
+			output: `locals {
+  list = [1, 2]
+  name = "${var.prefix}-b"
+}
+
+resource "null_resource" "a" {
+  triggers = {
+    id = "x"
+  }
+}
+
+resource "null_resource" "b" {
+  count = 2
+}
+`,
+		},
+		"hcl attributes shaped like blocks": {
+			codec: "hcl",
+			input: `
+rules = [{ port = 80 }]
+
+rule {
+  port = 443
+}
+
+module "a" {
+  settings = { web = [{ port = 8080 }] }
+}
+`,
+			expected: map[string]interface{}{
+				"rules": []interface{}{
+					map[string]interface{}{"port": float64(80)},
+				},
+				"rule": []interface{}{
+					map[string]interface{}{"port": float64(443)},
+				},
+				"module": map[string]interface{}{
+					"a": []interface{}{
+						map[string]interface{}{
+							"settings": map[string]interface{}{
+								"web": []interface{}{
+									map[string]interface{}{"port": float64(8080)},
+								},
+							},
+						},
+					},
+				},
+			},
+			output: `rules = [{
+  port = 80
+}]
+
+module "a" {
+  settings = {
+    web = [{
+      port = 8080
+    }]
+  }
+}
+
+rule {
+  port = 443
+}
+`,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			codec, ok := LookupCodec(tc.codec)
+			if !ok {
+				t.Fatalf("codec %q is not registered", tc.codec)
+			}
+
+			actual, codec, err := decode(codec, []byte(tc.input))
+			if err != nil {
+				t.Fatalf("unexpected error decoding: %v", err)
+			}
+			if diff := cmp.Diff(tc.expected, actual); len(diff) > 0 {
+				t.Fatalf("unexpected tree:\n%s", diff)
+			}
+
+			output, err := codec.Encode(actual)
+			if err != nil {
+				t.Fatalf("unexpected error encoding: %v", err)
+			}
+			if diff := cmp.Diff(tc.output, string(output)); len(diff) > 0 {
+				t.Fatalf("unexpected output:\n%s", diff)
+			}
+
+			// The written file must decode into the same tree, otherwise the
+			// golden files would never match the outputs.
+			roundTrip, err := codec.Decode(output)
+			if err != nil {
+				t.Fatalf("unexpected error decoding output: %v", err)
+			}
+			if diff := cmp.Diff(tc.expected, roundTrip); len(diff) > 0 {
+				t.Fatalf("unexpected tree after round trip:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCodecOverrides(t *testing.T) {
+	overrides := CodecOverrides{
+		"terraform.tfstate": "json",
+		"logs/*.log":        "ndjson",
+		"broken.json":       "raw",
+	}
+	if err := overrides.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tcs := map[string]struct {
+		file     string
+		contents string
+		codec    string
+	}{
+		"override":           {file: "terraform.tfstate", contents: `{}`, codec: "json"},
+		"pattern":            {file: "logs/apply.log", contents: `{}`, codec: "ndjson"},
+		"raw override":       {file: "broken.json", contents: `{`, codec: ""},
+		"extension":          {file: "values.yml", contents: `a: b`, codec: "yaml"},
+		"unknown extension":  {file: "output.txt", contents: `text`, codec: ""},
+		"pattern mismatches": {file: "logs/nested/apply.log", contents: `text`, codec: ""},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			file, err := overrides.NewFile(tc.file, []byte(tc.contents))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var codec string
+			if file.Codec() != nil {
+				codec = file.Codec().Name()
+			}
+			if codec != tc.codec {
+				t.Fatalf("expected codec %q, found %q", tc.codec, codec)
+			}
+		})
+	}
+}
+
+func TestCodecOverridesValidate(t *testing.T) {
+	err := CodecOverrides{"*.out": "toml"}.Validate()
+	if err == nil {
+		t.Fatalf("expected an error for an unrecognized codec")
+	}
+
+	expected := `codec for *.out: unrecognized codec "toml", expected one of hcl, json, ndjson, raw, yaml`
+	if err.Error() != expected {
+		t.Fatalf("expected %q, found %q", expected, err.Error())
+	}
+}
@@ -13,7 +13,7 @@ import (
 // CopyDir should be used in conjunction with filepath.WalkDir to recursively
 // copy all the files within sourceDirectory into targetDirectory.
 //
-// Any file names in skipFiles will be skipped.
+// Any file or directory names in skipFiles will be skipped.
 func CopyDir(sourceDirectory, targetDirectory string, skipFiles []string) fs.WalkDirFunc {
 	return func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
@@ -22,6 +22,9 @@ func CopyDir(sourceDirectory, targetDirectory string, skipFiles []string) fs.Wal
 
 		for _, skip := range skipFiles {
 			if skip == entry.Name() {
+				if entry.IsDir() {
+					return fs.SkipDir
+				}
 				return nil
 			}
 		}
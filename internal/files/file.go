@@ -3,25 +3,15 @@
 
 package files
 
-import (
-	"encoding/json"
-	"path/filepath"
-)
-
 const (
 	Json = "json"
 	Raw  = "raw"
 )
 
+// NewFile returns a File for the contents of file, decoded with the codec for
+// its extension. Files without a codec are read as plain text.
 func NewFile(file string, contents []byte) (*File, error) {
-	if filepath.Ext(file) == ".json" {
-		var data interface{}
-		if err := json.Unmarshal(contents, &data); err != nil {
-			return nil, err
-		}
-		return NewJsonFile(data), nil
-	}
-	return NewRawFile(string(contents)), nil
+	return CodecOverrides(nil).NewFile(file, contents)
 }
 
 func NewRawFile(contents string) *File {
@@ -32,21 +22,45 @@ func NewRawFile(contents string) *File {
 }
 
 func NewJsonFile(contents interface{}) *File {
+	return NewStructuredFile(jsonCodec{}, contents)
+}
+
+// NewStructuredFile returns a File holding a tree of values that is written
+// with codec.
+func NewStructuredFile(codec Codec, contents interface{}) *File {
 	return &File{
 		contents: contents,
 		ext:      Json,
+		codec:    codec,
 	}
 }
 
+// File is an output file of a test. Files either hold plain text, or a tree of
+// values that was decoded by a codec. The trees of every codec use the same
+// types as JSON, so Ext returns Json for all of them.
 type File struct {
 	contents interface{}
 	ext      string
+	codec    Codec
 }
 
 func (f File) Ext() string {
 	return f.ext
 }
 
+// Codec returns the codec that reads and writes the file, or nil if the file
+// holds plain text.
+func (f File) Codec() Codec {
+	return f.codec
+}
+
+// WithJson returns a copy of the file that holds contents instead, written
+// with the same codec.
+func (f File) WithJson(contents interface{}) *File {
+	f.contents = contents
+	return &f
+}
+
 func (f File) Json() (interface{}, bool) {
 	if f.ext == Json {
 		return f.contents, true
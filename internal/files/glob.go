@@ -0,0 +1,156 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package files
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Patterns chooses a set of files within a directory.
+//
+// Each pattern is a slash separated path, relative to the directory, where
+// each segment is matched using path.Match and a `**` segment matches any
+// number of directories. Wildcards don't match names that start with a `.`,
+// unless the segment of the pattern also starts with a `.`.
+//
+// If a pattern matches a directory, every file within that directory matches.
+type Patterns struct {
+	// Include lists the patterns for the files that should be chosen. Any
+	// pattern without wildcards must match an existing file or directory.
+	Include []string
+
+	// Exclude lists the patterns for the files that should not be chosen,
+	// even if they match one of the Include patterns.
+	Exclude []string
+}
+
+// Validate returns an error if any of the patterns are malformed.
+func (p Patterns) Validate() error {
+	for _, pattern := range append(append([]string{}, p.Include...), p.Exclude...) {
+		if err := validatePattern(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Find returns the relative, slash separated, paths of every file within
+// directory that matches the patterns, sorted by name.
+func (p Patterns) Find(directory string) ([]string, error) {
+	if len(p.Include) == 0 {
+		return nil, nil
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range p.Include {
+		if hasMeta(pattern) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(directory, filepath.FromSlash(pattern))); err != nil {
+			return nil, fmt.Errorf("could not read additional file (%s): %v", pattern, err)
+		}
+	}
+
+	var found []string
+	err := filepath.WalkDir(directory, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		relative, err := filepath.Rel(directory, file)
+		if err != nil {
+			return err
+		}
+		relative = filepath.ToSlash(relative)
+
+		if matchesAny(p.Include, relative) && !matchesAny(p.Exclude, relative) {
+			found = append(found, relative)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(found)
+	return found, nil
+}
+
+func validatePattern(pattern string) error {
+	if len(pattern) == 0 {
+		return fmt.Errorf("file patterns can't be empty")
+	}
+	if path.IsAbs(pattern) || path.Clean(pattern) == ".." || strings.HasPrefix(path.Clean(pattern), "../") {
+		return fmt.Errorf("invalid file pattern %q: patterns must be relative to the test directory", pattern)
+	}
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// matchesAny returns true if any of the patterns match the file, or one of the
+// directories that contains the file.
+func matchesAny(patterns []string, file string) bool {
+	segments := strings.Split(file, "/")
+	for _, pattern := range patterns {
+		patternSegments := strings.Split(path.Clean(pattern), "/")
+		for ix := range segments {
+			if matchSegments(patternSegments, segments[:ix+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern []string, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	if pattern[0] == "**" {
+		if matchSegments(pattern[1:], name) {
+			return true
+		}
+		return len(name) > 0 && !isHidden(name[0]) && matchSegments(pattern, name[1:])
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+
+	if isHidden(name[0]) && !strings.HasPrefix(pattern[0], ".") {
+		return false
+	}
+
+	// We've already validated the patterns, so we can ignore the error.
+	if matched, _ := path.Match(pattern[0], name[0]); !matched {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
+
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
@@ -0,0 +1,112 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPatternsFind(t *testing.T) {
+	directory := t.TempDir()
+	for _, file := range []string{
+		"main.tf",
+		"plan.json",
+		"terraform.resource/d199d8ea-e8f8-4fb0-8276-3567a74d3db8.json",
+		"terraform.resource/notes.txt",
+		"outputs/a.json",
+		"outputs/nested/b.json",
+		"outputs/nested/c.log",
+		".terraform/modules/modules.json",
+		".terraform.lock.hcl",
+	} {
+		target := filepath.Join(directory, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, nil, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcs := map[string]struct {
+		patterns Patterns
+		expected []string
+	}{
+		"empty": {},
+		"exact": {
+			patterns: Patterns{Include: []string{"plan.json"}},
+			expected: []string{"plan.json"},
+		},
+		"glob": {
+			patterns: Patterns{Include: []string{"terraform.resource/*.json"}},
+			expected: []string{"terraform.resource/d199d8ea-e8f8-4fb0-8276-3567a74d3db8.json"},
+		},
+		"double star skips hidden directories": {
+			patterns: Patterns{Include: []string{"**/*.json"}},
+			expected: []string{
+				"outputs/a.json",
+				"outputs/nested/b.json",
+				"plan.json",
+				"terraform.resource/d199d8ea-e8f8-4fb0-8276-3567a74d3db8.json",
+			},
+		},
+		"hidden files by name": {
+			patterns: Patterns{Include: []string{".terraform.lock.hcl", ".terraform/**/*.json"}},
+			expected: []string{".terraform.lock.hcl", ".terraform/modules/modules.json"},
+		},
+		"directory": {
+			patterns: Patterns{Include: []string{"outputs"}},
+			expected: []string{"outputs/a.json", "outputs/nested/b.json", "outputs/nested/c.log"},
+		},
+		"exclude": {
+			patterns: Patterns{
+				Include: []string{"outputs", "terraform.resource"},
+				Exclude: []string{"**/*.log", "terraform.resource/*.txt", "outputs/a.json"},
+			},
+			expected: []string{
+				"outputs/nested/b.json",
+				"terraform.resource/d199d8ea-e8f8-4fb0-8276-3567a74d3db8.json",
+			},
+		},
+		"exclude directory": {
+			patterns: Patterns{Include: []string{"outputs"}, Exclude: []string{"outputs/nested"}},
+			expected: []string{"outputs/a.json"},
+		},
+		"no matches": {
+			patterns: Patterns{Include: []string{"*.yaml"}},
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			actual, err := tc.patterns.Find(directory)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expected, actual); len(diff) > 0 {
+				t.Errorf("expected:\n%v\nactual:\n%v\ndiff:\n%s", tc.expected, actual, diff)
+			}
+		})
+	}
+}
+
+func TestPatternsFindErrors(t *testing.T) {
+	directory := t.TempDir()
+
+	for name, patterns := range map[string]Patterns{
+		"missing file":    {Include: []string{"missing.json"}},
+		"invalid pattern": {Include: []string{"[.json"}},
+		"outside":         {Include: []string{"../*.json"}},
+		"absolute":        {Include: []string{"/etc/*"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := patterns.Find(directory); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package files
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// expression matches the strings that hold the source of an expression that
+// couldn't be evaluated, eg. "${var.name}".
+var expression = regexp.MustCompile(`(?s)^\$\{(.*)\}$`)
+
+// hclCodec reads and writes HCL files, such as the configuration files written
+// by a local_file resource.
+//
+// The tree is an object with an entry for each attribute and block type.
+// Attributes that are constant values are evaluated, while any other
+// attributes (eg. references and function calls) are kept as the source of
+// their expression wrapped in ${ and }. The blocks of each type are nested
+// beneath an object for each of their labels, and then listed in order, so
+// `resource "a" "b" {}` becomes {"resource": {"a": {"b": [{}]}}}.
+//
+// Comments and formatting are not kept, and attributes are written in sorted
+// order.
+//
+// An attribute that holds a list of objects (eg. `rules = [{ port = 80 }]`)
+// has the same shape in the tree as a set of blocks. The codec returned for a
+// decoded file remembers which attributes these were, so they are written
+// back as attributes. Otherwise, such values are written as blocks.
+type hclCodec struct {
+	// attributes holds the hclPath of each attribute that has the shape of a
+	// set of blocks.
+	attributes map[string]bool
+}
+
+func (hclCodec) Name() string {
+	return "hcl"
+}
+
+func (c hclCodec) Decode(contents []byte) (interface{}, error) {
+	data, _, err := c.decodeFile(contents)
+	return data, err
+}
+
+func (hclCodec) decodeFile(contents []byte) (interface{}, Codec, error) {
+	file, diags := hclsyntax.ParseConfig(contents, "file.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, nil, diags
+	}
+
+	codec := hclCodec{attributes: map[string]bool{}}
+	data, err := codec.decodeHclBody(file.Body.(*hclsyntax.Body), contents, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, codec, nil
+}
+
+// hclPath identifies an attribute or a set of blocks by the names of the
+// blocks and labels above it, and its own name. The position of each block
+// within a set of blocks is left out, so removing blocks from the tree
+// doesn't change the path of anything else.
+func hclPath(parents []string, name string) string {
+	return fmt.Sprintf("%q", append(parents[:len(parents):len(parents)], name))
+}
+
+func (c hclCodec) decodeHclBody(body *hclsyntax.Body, contents []byte, parents []string) (map[string]interface{}, error) {
+	ret := map[string]interface{}{}
+	for name, attribute := range body.Attributes {
+		value, diags := attribute.Expr.Value(nil)
+		if diags.HasErrors() || !value.IsWhollyKnown() {
+			ret[name] = fmt.Sprintf("${%s}", attribute.Expr.Range().SliceBytes(contents))
+			continue
+		}
+
+		data, err := fromCty(value)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", name, err)
+		}
+		if hclBlockDepth(data) >= 0 {
+			c.attributes[hclPath(parents, name)] = true
+		}
+		ret[name] = data
+	}
+
+	labels := map[string]int{}
+	for _, block := range body.Blocks {
+		if _, ok := body.Attributes[block.Type]; ok {
+			return nil, fmt.Errorf("%s is both an attribute and a block", block.Type)
+		}
+		if count, ok := labels[block.Type]; ok && count != len(block.Labels) {
+			return nil, fmt.Errorf("blocks of type %s have different numbers of labels", block.Type)
+		}
+		labels[block.Type] = len(block.Labels)
+
+		content, err := c.decodeHclBody(block.Body, contents, append(append(parents[:len(parents):len(parents)], block.Type), block.Labels...))
+		if err != nil {
+			return nil, err
+		}
+
+		parent, key := ret, block.Type
+		for _, label := range block.Labels {
+			child, ok := parent[key].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				parent[key] = child
+			}
+			parent, key = child, label
+		}
+
+		blocks, _ := parent[key].([]interface{})
+		parent[key] = append(blocks, content)
+	}
+	return ret, nil
+}
+
+func (c hclCodec) Encode(data interface{}) ([]byte, error) {
+	object, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("hcl files must contain an object, found %T", data)
+	}
+
+	file := hclwrite.NewEmptyFile()
+	if err := c.encodeHclBody(file.Body(), object, nil); err != nil {
+		return nil, err
+	}
+	return file.Bytes(), nil
+}
+
+func (c hclCodec) encodeHclBody(body *hclwrite.Body, object map[string]interface{}, parents []string) error {
+	var keys []string
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// We write the attributes before the blocks, which is how most HCL files
+	// are laid out.
+	var blocks []string
+	for _, key := range keys {
+		if hclBlockDepth(object[key]) >= 0 && !c.attributes[hclPath(parents, key)] {
+			blocks = append(blocks, key)
+			continue
+		}
+
+		if !hclsyntax.ValidIdentifier(key) {
+			return fmt.Errorf("%q is not a valid attribute name", key)
+		}
+
+		if source, ok := object[key].(string); ok {
+			if match := expression.FindStringSubmatch(source); match != nil {
+				if tokens, ok := hclExpressionTokens(match[1]); ok {
+					body.SetAttributeRaw(key, tokens)
+					continue
+				}
+			}
+		}
+
+		value, err := toCty(object[key])
+		if err != nil {
+			return fmt.Errorf("attribute %s: %w", key, err)
+		}
+		body.SetAttributeValue(key, value)
+	}
+
+	for _, key := range blocks {
+		if err := c.encodeHclBlocks(body, key, nil, object[key], parents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c hclCodec) encodeHclBlocks(body *hclwrite.Body, blockType string, labels []string, value interface{}, parents []string) error {
+	switch value := value.(type) {
+	case []interface{}:
+		for _, content := range value {
+			if len(body.Attributes()) > 0 || len(body.Blocks()) > 0 {
+				body.AppendNewline()
+			}
+			block := body.AppendNewBlock(blockType, labels)
+			if err := c.encodeHclBody(block.Body(), content.(map[string]interface{}), append(append(parents[:len(parents):len(parents)], blockType), labels...)); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		var keys []string
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if err := c.encodeHclBlocks(body, blockType, append(labels[:len(labels):len(labels)], key), value[key], parents); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hclBlockDepth returns the number of labels if value has the shape of a set
+// of blocks, or -1 if it should be written as an attribute.
+//
+// A non-empty list of objects whose keys are all valid names is a set of
+// blocks without labels. A non-empty object whose values are all sets of
+// blocks with the same number of labels adds another label.
+func hclBlockDepth(value interface{}) int {
+	switch value := value.(type) {
+	case []interface{}:
+		if len(value) == 0 {
+			return -1
+		}
+		for _, item := range value {
+			object, ok := item.(map[string]interface{})
+			if !ok {
+				return -1
+			}
+			for key := range object {
+				if !hclsyntax.ValidIdentifier(key) {
+					return -1
+				}
+			}
+		}
+		return 0
+	case map[string]interface{}:
+		depth := -1
+		for _, item := range value {
+			child := hclBlockDepth(item)
+			if child < 0 || (depth >= 0 && child+1 != depth) {
+				return -1
+			}
+			depth = child + 1
+		}
+		return depth
+	default:
+		return -1
+	}
+}
+
+// hclExpressionTokens returns the tokens for the source of an expression, or
+// false if the source isn't a valid expression.
+func hclExpressionTokens(source string) (hclwrite.Tokens, bool) {
+	if _, diags := hclsyntax.ParseExpression([]byte(source), "expression", hcl.InitialPos); diags.HasErrors() {
+		return nil, false
+	}
+
+	file, diags := hclwrite.ParseConfig([]byte(fmt.Sprintf("value = %s\n", source)), "expression", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, false
+	}
+
+	attribute := file.Body().GetAttribute("value")
+	if attribute == nil {
+		return nil, false
+	}
+	return attribute.Expr().BuildTokens(nil), true
+}
+
+func fromCty(value cty.Value) (interface{}, error) {
+	data, err := ctyjson.Marshal(value, value.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	var ret interface{}
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func toCty(value interface{}) (cty.Value, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return cty.NilVal, err
+	}
+
+	ty, err := ctyjson.ImpliedType(data)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return ctyjson.Unmarshal(data, ty)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package files
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlCodec reads and writes YAML files that contain a single document.
+type yamlCodec struct{}
+
+func (yamlCodec) Name() string {
+	return "yaml"
+}
+
+func (yamlCodec) Decode(contents []byte) (interface{}, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		if errors.Is(err, io.EOF) {
+			// An empty file is an empty document.
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var next interface{}
+	if err := decoder.Decode(&next); !errors.Is(err, io.EOF) {
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New("yaml files with multiple documents are not supported")
+	}
+
+	return fromYaml(data)
+}
+
+func (yamlCodec) Encode(data interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(data); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// fromYaml converts the values decoded by the YAML library into the types
+// encoding/json uses, so YAML files can be processed in the same way as JSON
+// files.
+func fromYaml(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			converted, err := fromYaml(item)
+			if err != nil {
+				return nil, err
+			}
+			value[key] = converted
+		}
+		return value, nil
+	case map[interface{}]interface{}:
+		ret := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			converted, err := fromYaml(item)
+			if err != nil {
+				return nil, err
+			}
+			ret[fmt.Sprint(key)] = converted
+		}
+		return ret, nil
+	case []interface{}:
+		for ix, item := range value {
+			converted, err := fromYaml(item)
+			if err != nil {
+				return nil, err
+			}
+			value[ix] = converted
+		}
+		return value, nil
+	case int:
+		return float64(value), nil
+	case int64:
+		return float64(value), nil
+	case uint64:
+		return float64(value), nil
+	case float64, string, bool, nil:
+		return value, nil
+	case time.Time:
+		return value.Format(time.RFC3339Nano), nil
+	default:
+		return nil, fmt.Errorf("unsupported yaml value of type %T", value)
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package json
+
+// Copy returns a deep copy of the JSON data, so it can be passed into Strip
+// or Mask without changing the original.
+func Copy(data interface{}) interface{} {
+	switch data := data.(type) {
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(data))
+		for key, value := range data {
+			ret[key] = Copy(value)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(data))
+		for ix, value := range data {
+			ret[ix] = Copy(value)
+		}
+		return ret
+	default:
+		return data
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package json
+
+import (
+	"fmt"
+)
+
+// Mask mutates the input data by replacing the values of all the required
+// fields with a placeholder of the same type. Unlike Strip, the fields are
+// kept, so the structure of the data can still be compared while the values
+// are ignored.
+//
+// The fields use the same format as Strip, and the placeholders are:
+//   - "<masked:string>" for strings,
+//   - 0 for numbers,
+//   - false for booleans.
+//
+// Objects and arrays keep their keys and elements, and every value within them
+// is masked instead.
+//
+// Null values are left as null. Fields that don't exist are not added.
+func Mask(fields []string, data interface{}) (interface{}, error) {
+	return new(Report).Mask(fields, data)
+}
+
+// Mask is the same as the package level Mask function, but records any
+// warnings in the report.
+func (r *Report) Mask(fields []string, data interface{}) (interface{}, error) {
+	return r.Transform(fields, data, maskValue)
+}
+
+// maskValue returns the placeholder for value, or a copy of value with every
+// value within it masked if it is an object or an array.
+func maskValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return "<masked:string>"
+	case float64:
+		return float64(0)
+	case bool:
+		return false
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			ret[key] = maskValue(item)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(value))
+		for ix, item := range value {
+			ret[ix] = maskValue(item)
+		}
+		return ret
+	default:
+		return fmt.Sprintf("<masked:%T>", value)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestMaskJson(t *testing.T) {
+	tcs := []struct {
+		input    string
+		expected string
+		fields   []string
+	}{
+		{
+			input:    `{"id": "abc", "count": 3, "enabled": true, "tags": ["a"], "nested": {"a": 1}, "empty": null}`,
+			expected: `{"count":0,"empty":null,"enabled":false,"id":"<masked:string>","nested":{"a":0},"tags":["<masked:string>"]}`,
+			fields:   []string{"id", "count", "enabled", "tags", "nested", "empty"},
+		},
+		{
+			input:    `{"id": "abc"}`,
+			expected: `{"id":"<masked:string>"}`,
+			fields:   []string{"id", "missing", "missing.nested"},
+		},
+		{
+			input:    `{"resources": [{"id": "a", "name": "one"}, {"id": "b", "name": "two"}]}`,
+			expected: `{"resources":[{"id":"<masked:string>","name":"one"},{"id":"<masked:string>","name":"two"}]}`,
+			fields:   []string{"resources.*.id"},
+		},
+		{
+			input:    `{"values": {"a": "x", "b": 2}, "list": ["x", 1, false]}`,
+			expected: `{"list":["x",0,false],"values":{"a":"<masked:string>","b":0}}`,
+			fields:   []string{"values.*", "list.1"},
+		},
+		{
+			input:    `{"values": {"tags": {"Name": "x", "Count": [1, {"deep": true}]}, "empty": {}, "none": []}}`,
+			expected: `{"values":{"empty":{},"none":[],"tags":{"Count":[0,{"deep":false}],"Name":"<masked:string>"}}}`,
+			fields:   []string{"values"},
+		},
+	}
+	for ix, tc := range tcs {
+		t.Run(fmt.Sprintf("%d", ix), func(t *testing.T) {
+			var input interface{}
+			if err := json.Unmarshal([]byte(tc.input), &input); err != nil {
+				t.Fatalf("could not parse input: %v", err)
+			}
+
+			actual, err := Mask(tc.fields, input)
+			if err != nil {
+				t.Fatalf("call to Mask failed unexpectedly: %v", err)
+			}
+
+			actualStr, err := json.Marshal(actual)
+			if err != nil {
+				t.Fatalf("could not convert actual into bytes: %v", err)
+			}
+
+			var expected interface{}
+			if err := json.Unmarshal([]byte(tc.expected), &expected); err != nil {
+				t.Fatalf("could not parse expected: %v", err)
+			}
+
+			expectedStr, err := json.Marshal(expected)
+			if err != nil {
+				t.Fatalf("could not convert expected into bytes: %v", err)
+			}
+
+			if string(actualStr) != string(expectedStr) {
+				t.Fatalf("actual does not equal expected\nexpected:\n\t%s\nactual:\n\t%s\n", string(expectedStr), string(actualStr))
+			}
+		})
+	}
+}
@@ -0,0 +1,502 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package json
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	wildcard  = "*"
+	recursive = "**"
+)
+
+type segmentKind int
+
+const (
+	// nameSegment is a plain segment, eg. `values` or `0`. It selects a key
+	// within an object, or an index within an array if it is an integer.
+	// Negative indexes count back from the end of the array.
+	nameSegment segmentKind = iota
+
+	// keySegment is a quoted segment, eg. `"a.b"`. It only selects a key
+	// within an object.
+	keySegment
+
+	// wildcardSegment is `*`, and selects every key or element.
+	wildcardSegment
+
+	// recursiveSegment is `**`, and matches any number of levels, including
+	// none.
+	recursiveSegment
+
+	// predicateSegment is one or more predicates, eg.
+	// `[address=null_resource.x]`. It selects every element whose fields have
+	// the given values.
+	predicateSegment
+)
+
+type segment struct {
+	kind segmentKind
+	name string
+
+	// predicates are only set for predicate segments.
+	predicates []predicate
+}
+
+func (s segment) String() string {
+	switch s.kind {
+	case keySegment:
+		return strconv.Quote(s.name)
+	case predicateSegment:
+		var builder strings.Builder
+		for _, predicate := range s.predicates {
+			builder.WriteString(predicate.String())
+		}
+		return builder.String()
+	default:
+		return s.name
+	}
+}
+
+// matches returns true if value is an object that matches every predicate of
+// the segment.
+func (s segment) matches(value interface{}) bool {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	for _, predicate := range s.predicates {
+		if !predicate.matches(object) {
+			return false
+		}
+	}
+	return true
+}
+
+// predicate matches objects whose field has the given value.
+type predicate struct {
+	field  string
+	value  string
+	quoted bool
+}
+
+func (p predicate) String() string {
+	value := p.value
+	if p.quoted {
+		value = strconv.Quote(value)
+	}
+	return fmt.Sprintf("[%s=%s]", p.field, value)
+}
+
+// matches returns true if the field of object equals the value of the
+// predicate.
+//
+// Quoted values only match strings. Unquoted values match strings, numbers,
+// booleans, and null by their JSON representation.
+func (p predicate) matches(object map[string]interface{}) bool {
+	actual, ok := object[p.field]
+	if !ok {
+		return false
+	}
+
+	switch actual := actual.(type) {
+	case string:
+		return actual == p.value
+	case float64:
+		return !p.quoted && strconv.FormatFloat(actual, 'f', -1, 64) == p.value
+	case bool:
+		return !p.quoted && strconv.FormatBool(actual) == p.value
+	case nil:
+		return !p.quoted && p.value == "null"
+	default:
+		return false
+	}
+}
+
+// Validate returns an error if any of the fields don't use the syntax
+// accepted by Strip.
+func Validate(fields []string) error {
+	for _, field := range fields {
+		if _, err := parsePath(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parsePath splits a field into its segments.
+func parsePath(field string) ([]segment, error) {
+	p := &pathParser{field: field}
+
+	segments, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid field %q: %w", field, err)
+	}
+	return segments, nil
+}
+
+type pathParser struct {
+	field string
+	pos   int
+}
+
+func (p *pathParser) parse() ([]segment, error) {
+	if len(p.field) == 0 {
+		return nil, fmt.Errorf("fields can't be empty")
+	}
+
+	var segments []segment
+	for {
+		switch {
+		case p.peek() == '"':
+			name, err := p.quoted()
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, segment{kind: keySegment, name: name})
+		case p.peek() == '[':
+			// Predicates can directly follow another segment, or start a
+			// segment of their own.
+		default:
+			start := p.pos
+			for p.pos < len(p.field) && p.field[p.pos] != '.' && p.field[p.pos] != '[' {
+				p.pos++
+			}
+
+			name := p.field[start:p.pos]
+			switch name {
+			case "":
+				return nil, fmt.Errorf("empty segment at position %d", start)
+			case wildcard:
+				segments = append(segments, segment{kind: wildcardSegment, name: name})
+			case recursive:
+				segments = append(segments, segment{kind: recursiveSegment, name: name})
+			default:
+				segments = append(segments, segment{kind: nameSegment, name: name})
+			}
+		}
+
+		if p.peek() == '[' {
+			// Consecutive predicates all apply to the same elements.
+			predicates := segment{kind: predicateSegment}
+			for p.peek() == '[' {
+				predicate, err := p.predicate()
+				if err != nil {
+					return nil, err
+				}
+				predicates.predicates = append(predicates.predicates, predicate)
+			}
+			segments = append(segments, predicates)
+		}
+
+		if p.pos == len(p.field) {
+			break
+		}
+
+		if p.peek() != '.' {
+			return nil, fmt.Errorf("expected . at position %d", p.pos)
+		}
+		p.pos++
+		if p.pos == len(p.field) {
+			return nil, fmt.Errorf("fields can't end with .")
+		}
+	}
+
+	if segments[len(segments)-1].kind == recursiveSegment {
+		return nil, fmt.Errorf("%s must be followed by another segment", recursive)
+	}
+	return segments, nil
+}
+
+func (p *pathParser) peek() byte {
+	if p.pos < len(p.field) {
+		return p.field[p.pos]
+	}
+	return 0
+}
+
+// quoted reads a double-quoted string, where \" and \\ are escapes for " and
+// \ respectively.
+func (p *pathParser) quoted() (string, error) {
+	start := p.pos
+	p.pos++
+
+	var builder strings.Builder
+	for p.pos < len(p.field) {
+		switch c := p.field[p.pos]; c {
+		case '\\':
+			if p.pos+1 == len(p.field) {
+				return "", fmt.Errorf("unterminated quote at position %d", start)
+			}
+			builder.WriteByte(p.field[p.pos+1])
+			p.pos += 2
+		case '"':
+			p.pos++
+			return builder.String(), nil
+		default:
+			builder.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", fmt.Errorf("unterminated quote at position %d", start)
+}
+
+// predicate reads a predicate in the form [field=value], where both the
+// field and the value can be quoted.
+func (p *pathParser) predicate() (predicate, error) {
+	start := p.pos
+	p.pos++
+
+	read := func(terminator byte) (string, bool, error) {
+		if p.peek() == '"' {
+			value, err := p.quoted()
+			return value, true, err
+		}
+
+		begin := p.pos
+		for p.pos < len(p.field) && p.field[p.pos] != terminator && p.field[p.pos] != ']' {
+			p.pos++
+		}
+		return p.field[begin:p.pos], false, nil
+	}
+
+	field, _, err := read('=')
+	if err != nil {
+		return predicate{}, err
+	}
+	if len(field) == 0 || p.peek() != '=' {
+		return predicate{}, fmt.Errorf("invalid predicate at position %d, expected [field=value]", start)
+	}
+	p.pos++
+
+	value, quoted, err := read(']')
+	if err != nil {
+		return predicate{}, err
+	}
+	if p.peek() != ']' {
+		return predicate{}, fmt.Errorf("unterminated predicate at position %d", start)
+	}
+	p.pos++
+
+	return predicate{field: field, value: value, quoted: quoted}, nil
+}
+
+// Report records what happened when fields were applied to some JSON data.
+type Report struct {
+	// Warnings lists any problems with the fields that didn't stop them being
+	// applied, such as an index that was out of range.
+	Warnings []string
+
+	// Hits counts the values that were selected by each field. A field that
+	// was applied but selected nothing has a count of zero.
+	Hits map[string]int
+}
+
+func (r *Report) warn(field string, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf("field %q: %s", field, fmt.Sprintf(format, args...)))
+}
+
+// operation applies a change to every value selected by a single field.
+type operation struct {
+	field  string
+	report *Report
+
+	// lenient is set beneath a ** segment, where the remaining segments are
+	// tried against every value. Values that don't fit the remaining segments
+	// are skipped instead of reported.
+	lenient bool
+
+	// leaf is called for every value selected by the field. It returns the
+	// new value, and false if the value should be removed instead.
+	leaf func(value interface{}) (interface{}, bool)
+}
+
+// apply parses the field and applies the operation to data.
+func (r *Report) apply(field string, data interface{}, leaf func(value interface{}) (interface{}, bool)) (interface{}, error) {
+	segments, err := parsePath(field)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Hits == nil {
+		r.Hits = map[string]int{}
+	}
+	r.Hits[field] += 0
+
+	op := operation{
+		field:  field,
+		report: r,
+		leaf: func(value interface{}) (interface{}, bool) {
+			r.Hits[field]++
+			return leaf(value)
+		},
+	}
+	return op.apply(segments, data)
+}
+
+func (op operation) apply(segments []segment, current interface{}) (interface{}, error) {
+	if current == nil {
+		return nil, nil
+	}
+
+	if segments[0].kind == recursiveSegment {
+		return op.recurse(segments, current)
+	}
+
+	switch node := current.(type) {
+	case map[string]interface{}:
+		return op.applyMap(segments, node)
+	case []interface{}:
+		return op.applySlice(segments, node)
+	default:
+		if op.lenient {
+			return current, nil
+		}
+		return nil, fmt.Errorf("unrecognized json type: %T", node)
+	}
+}
+
+// recurse applies the segments after a ** segment at the current level, and
+// at every level beneath it.
+func (op operation) recurse(segments []segment, current interface{}) (interface{}, error) {
+	if !isContainer(current) {
+		return current, nil
+	}
+
+	op.lenient = true
+	current, err := op.apply(segments[1:], current)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node := current.(type) {
+	case map[string]interface{}:
+		for key, value := range node {
+			if node[key], err = op.recurse(segments, value); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for ix, value := range node {
+			if node[ix], err = op.recurse(segments, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return current, nil
+}
+
+func (op operation) applyMap(segments []segment, current map[string]interface{}) (map[string]interface{}, error) {
+	var keys []string
+	switch s := segments[0]; s.kind {
+	case wildcardSegment:
+		for key := range current {
+			keys = append(keys, key)
+		}
+	case predicateSegment:
+		for key, value := range current {
+			if s.matches(value) {
+				keys = append(keys, key)
+			}
+		}
+	default:
+		if _, ok := current[s.name]; ok {
+			keys = append(keys, s.name)
+		}
+		// If the JSON object doesn't have this path, just skip it.
+	}
+
+	for _, key := range keys {
+		if len(segments) == 1 {
+			value, keep := op.leaf(current[key])
+			if keep {
+				current[key] = value
+			} else {
+				delete(current, key)
+			}
+			continue
+		}
+
+		var err error
+		if current[key], err = op.apply(segments[1:], current[key]); err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+func (op operation) applySlice(segments []segment, current []interface{}) ([]interface{}, error) {
+	selected := map[int]bool{}
+	switch s := segments[0]; s.kind {
+	case wildcardSegment:
+		for ix := range current {
+			selected[ix] = true
+		}
+	case predicateSegment:
+		for ix, value := range current {
+			if s.matches(value) {
+				selected[ix] = true
+			}
+		}
+	default:
+		ix, err := strconv.Atoi(s.name)
+		if s.kind == keySegment || err != nil {
+			if op.lenient {
+				return current, nil
+			}
+			return nil, fmt.Errorf("must specify an integer when referencing json arrays, instead specified %s", s)
+		}
+
+		if ix < 0 {
+			ix += len(current)
+		}
+		if ix < 0 || ix >= len(current) {
+			if op.lenient {
+				return current, nil
+			}
+			op.report.warn(op.field, "index %s is out of range for an array of %d element(s), skipping", s.name, len(current))
+			return current, nil
+		}
+		selected[ix] = true
+	}
+
+	if len(segments) == 1 {
+		ret := make([]interface{}, 0, len(current))
+		for ix, value := range current {
+			if selected[ix] {
+				var keep bool
+				if value, keep = op.leaf(value); !keep {
+					continue
+				}
+			}
+			ret = append(ret, value)
+		}
+		return ret, nil
+	}
+
+	for ix := range current {
+		if !selected[ix] {
+			continue
+		}
+
+		var err error
+		if current[ix], err = op.apply(segments[1:], current[ix]); err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+func isContainer(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	default:
+		return false
+	}
+}
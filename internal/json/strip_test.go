@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestStripJson(t *testing.T) {
@@ -326,3 +328,213 @@ func TestStripJson(t *testing.T) {
 		})
 	}
 }
+
+func TestStripJsonPathSyntax(t *testing.T) {
+	tcs := map[string]struct {
+		input    string
+		expected string
+		fields   []string
+		warnings []string
+	}{
+		"quoted key": {
+			input:    `{"a.b": 1, "a": {"b": 2}}`,
+			expected: `{"a": {"b": 2}}`,
+			fields:   []string{`"a.b"`},
+		},
+		"quoted key with escapes": {
+			input:    `{"say \"hi\"": 1, "other": 2}`,
+			expected: `{"other": 2}`,
+			fields:   []string{`"say \"hi\""`},
+		},
+		"quoted key within path": {
+			input:    `{"tags": {"kubernetes.io/name": "x", "name": "y"}}`,
+			expected: `{"tags": {"name": "y"}}`,
+			fields:   []string{`tags."kubernetes.io/name"`},
+		},
+		"recursive": {
+			input:    `{"id": 1, "a": {"id": 2, "b": [{"id": 3, "c": 4}]}, "d": "id"}`,
+			expected: `{"a": {"b": [{"c": 4}]}, "d": "id"}`,
+			fields:   []string{"**.id"},
+		},
+		"recursive within path": {
+			input:    `{"a": {"b": {"id": 1}, "id": 2}, "id": 3}`,
+			expected: `{"a": {"b": {}}, "id": 3}`,
+			fields:   []string{"a.**.id"},
+		},
+		"predicate": {
+			input:    `{"resource_changes": [{"address": "null_resource.x", "a": 1}, {"address": "null_resource.y", "a": 2}]}`,
+			expected: `{"resource_changes": [{"address": "null_resource.y", "a": 2}]}`,
+			fields:   []string{"resource_changes[address=null_resource.x]"},
+		},
+		"predicate within path": {
+			input:    `{"resource_changes": [{"address": "null_resource.x", "a": 1}, {"address": "null_resource.y", "a": 2}]}`,
+			expected: `{"resource_changes": [{"address": "null_resource.x"}, {"address": "null_resource.y", "a": 2}]}`,
+			fields:   []string{"resource_changes[address=null_resource.x].a"},
+		},
+		"predicate with quoted value": {
+			input:    `{"list": [{"key": "a]b"}, {"key": "c"}]}`,
+			expected: `{"list": [{"key": "c"}]}`,
+			fields:   []string{`list[key="a]b"]`},
+		},
+		"predicate with number": {
+			input:    `{"list": [{"index": 1}, {"index": 2}, {"index": "1"}]}`,
+			expected: `{"list": [{"index": 2}]}`,
+			fields:   []string{"list[index=1]"},
+		},
+		"predicate with quoted number": {
+			input:    `{"list": [{"index": 1}, {"index": 2}, {"index": "1"}]}`,
+			expected: `{"list": [{"index": 1}, {"index": 2}]}`,
+			fields:   []string{`list[index="1"]`},
+		},
+		"predicate on object": {
+			input:    `{"outputs": {"a": {"sensitive": true}, "b": {"sensitive": false}}}`,
+			expected: `{"outputs": {"b": {"sensitive": false}}}`,
+			fields:   []string{"outputs[sensitive=true]"},
+		},
+		"multiple predicates": {
+			input:    `{"list": [{"a": 1, "b": 1}, {"a": 1, "b": 2}]}`,
+			expected: `{"list": [{"a": 1, "b": 2}]}`,
+			fields:   []string{"list[a=1][b=1]"},
+		},
+		"negative index": {
+			input:    `{"list": [1, 2, 3]}`,
+			expected: `{"list": [1, 2]}`,
+			fields:   []string{"list.-1"},
+		},
+		"negative index within path": {
+			input:    `[{"a": 1, "b": 1}, {"a": 2, "b": 2}]`,
+			expected: `[{"a": 1, "b": 1}, {"b": 2}]`,
+			fields:   []string{"-1.a"},
+		},
+		"index out of range": {
+			input:    `{"list": [1, 2, 3]}`,
+			expected: `{"list": [1, 2, 3]}`,
+			fields:   []string{"list.3", "list.-4"},
+			warnings: []string{
+				`field "list.3": index 3 is out of range for an array of 3 element(s), skipping`,
+				`field "list.-4": index -4 is out of range for an array of 3 element(s), skipping`,
+			},
+		},
+		"wildcard leaves empty lists": {
+			input:    `{"list": []}`,
+			expected: `{"list": []}`,
+			fields:   []string{"list.*.a"},
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			var input interface{}
+			if err := json.Unmarshal([]byte(tc.input), &input); err != nil {
+				t.Fatalf("could not parse input: %v", err)
+			}
+
+			var report Report
+			actual, err := report.Strip(tc.fields, input)
+			if err != nil {
+				t.Fatalf("call to Strip failed unexpectedly: %v", err)
+			}
+
+			actualStr, err := json.Marshal(actual)
+			if err != nil {
+				t.Fatalf("could not convert actual into bytes: %v", err)
+			}
+
+			var expected interface{}
+			if err := json.Unmarshal([]byte(tc.expected), &expected); err != nil {
+				t.Fatalf("could not parse expected: %v", err)
+			}
+
+			expectedStr, err := json.Marshal(expected)
+			if err != nil {
+				t.Fatalf("could not convert expected into bytes: %v", err)
+			}
+
+			if string(actualStr) != string(expectedStr) {
+				t.Fatalf("actual does not equal expected\nexpected:\n\t%s\nactual:\n\t%s\n", string(expectedStr), string(actualStr))
+			}
+
+			if diff := cmp.Diff(tc.warnings, report.Warnings); len(diff) > 0 {
+				t.Fatalf("unexpected warnings:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStripJsonHits(t *testing.T) {
+	var input interface{}
+	if err := json.Unmarshal([]byte(`{"list": [{"id": 1}, {"id": 2}, {}], "id": 3}`), &input); err != nil {
+		t.Fatalf("could not parse input: %v", err)
+	}
+
+	var report Report
+	if _, err := report.Strip([]string{"list.*.id", "missing", "id"}, input); err != nil {
+		t.Fatalf("call to Strip failed unexpectedly: %v", err)
+	}
+
+	expected := map[string]int{
+		"list.*.id": 2,
+		"missing":   0,
+		"id":        1,
+	}
+	if diff := cmp.Diff(expected, report.Hits); len(diff) > 0 {
+		t.Fatalf("unexpected hits:\n%s", diff)
+	}
+}
+
+func TestValidateFields(t *testing.T) {
+	tcs := map[string]struct {
+		field string
+		err   string
+	}{
+		"valid": {
+			field: `a."b.c".**.d[e="f"].-1`,
+		},
+		"empty": {
+			field: "",
+			err:   `invalid field "": fields can't be empty`,
+		},
+		"empty segment": {
+			field: "a..b",
+			err:   `invalid field "a..b": empty segment at position 2`,
+		},
+		"trailing dot": {
+			field: "a.",
+			err:   `invalid field "a.": fields can't end with .`,
+		},
+		"trailing recursive": {
+			field: "a.**",
+			err:   `invalid field "a.**": ** must be followed by another segment`,
+		},
+		"unterminated quote": {
+			field: `a."b`,
+			err:   `invalid field "a.\"b": unterminated quote at position 2`,
+		},
+		"text after quote": {
+			field: `"a"b`,
+			err:   `invalid field "\"a\"b": expected . at position 3`,
+		},
+		"predicate without value": {
+			field: "a[b]",
+			err:   `invalid field "a[b]": invalid predicate at position 1, expected [field=value]`,
+		},
+		"predicate without value in path": {
+			field: "a[b].c[d=e]",
+			err:   `invalid field "a[b].c[d=e]": invalid predicate at position 1, expected [field=value]`,
+		},
+		"unterminated predicate": {
+			field: "a[b=c",
+			err:   `invalid field "a[b=c": unterminated predicate at position 1`,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			var actual string
+			if err := Validate([]string{tc.field}); err != nil {
+				actual = err.Error()
+			}
+			if actual != tc.err {
+				t.Fatalf("expected error %q, found %q", tc.err, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package json
+
+// Transform mutates the input data by replacing the values of all the
+// required fields with the result of calling transform on them.
+//
+// The fields use the same format as Strip. Fields that don't exist are
+// skipped, so transform is only called for values that exist.
+func Transform(fields []string, data interface{}, transform func(value interface{}) interface{}) (interface{}, error) {
+	return new(Report).Transform(fields, data, transform)
+}
+
+// Transform is the same as the package level Transform function, but records
+// any warnings in the report.
+func (r *Report) Transform(fields []string, data interface{}, transform func(value interface{}) interface{}) (interface{}, error) {
+	for _, field := range fields {
+		var err error
+		data, err = r.apply(field, data, func(value interface{}) (interface{}, bool) {
+			return transform(value), true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
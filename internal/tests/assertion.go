@@ -0,0 +1,239 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/tryfunc"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Assertion is a condition that must hold for the outputs of a test,
+// regardless of what the golden files contain.
+//
+// The Condition is an HCL expression that must evaluate to true. The captured
+// output files are available in the `files` object, keyed by their file name
+// (eg. `files["plan.json"]`). JSON files are available as objects, and every
+// other file is available as a string.
+type Assertion struct {
+	// Description explains what the assertion checks, and is included in the
+	// report if it fails.
+	Description string `json:"description,omitempty"`
+
+	// Condition is the HCL expression that is evaluated.
+	Condition string `json:"condition"`
+}
+
+// AssertionFailure describes an assertion that didn't hold for the outputs of
+// a test.
+type AssertionFailure struct {
+	Assertion Assertion
+	Reason    string
+}
+
+func (failure AssertionFailure) String() string {
+	if len(failure.Assertion.Description) > 0 {
+		return fmt.Sprintf("%s (%s): %s", failure.Assertion.Description, failure.Assertion.Condition, failure.Reason)
+	}
+	return fmt.Sprintf("%s: %s", failure.Assertion.Condition, failure.Reason)
+}
+
+var (
+	// assertionFunctions are the functions that can be called from the
+	// condition of an assertion.
+	assertionFunctions = map[string]function.Function{
+		"alltrue":    allTrueFunc,
+		"anytrue":    anyTrueFunc,
+		"can":        tryfunc.CanFunc,
+		"contains":   stdlib.ContainsFunc,
+		"flatten":    stdlib.FlattenFunc,
+		"jsondecode": stdlib.JSONDecodeFunc,
+		"jsonencode": stdlib.JSONEncodeFunc,
+		"keys":       stdlib.KeysFunc,
+		"length":     stdlib.LengthFunc,
+		"lookup":     stdlib.LookupFunc,
+		"lower":      stdlib.LowerFunc,
+		"regex":      stdlib.RegexFunc,
+		"regexall":   stdlib.RegexAllFunc,
+		"strcontains": function.New(&function.Spec{
+			Params: []function.Parameter{
+				{Name: "str", Type: cty.String},
+				{Name: "substr", Type: cty.String},
+			},
+			Type: function.StaticReturnType(cty.Bool),
+			Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+				return cty.BoolVal(strings.Contains(args[0].AsString(), args[1].AsString())), nil
+			},
+		}),
+		"strlen": stdlib.StrlenFunc,
+		"try":    tryfunc.TryFunc,
+		"upper":  stdlib.UpperFunc,
+		"values": stdlib.ValuesFunc,
+	}
+
+	allTrueFunc = boolListFunc(func(values []bool) bool {
+		for _, value := range values {
+			if !value {
+				return false
+			}
+		}
+		return true
+	})
+
+	anyTrueFunc = boolListFunc(func(values []bool) bool {
+		for _, value := range values {
+			if value {
+				return true
+			}
+		}
+		return false
+	})
+)
+
+// boolListFunc returns a function that accepts a list or tuple of booleans,
+// and reduces them into a single boolean with reduce.
+func boolListFunc(reduce func([]bool) bool) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "list", Type: cty.DynamicPseudoType},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			list := args[0]
+			if !list.CanIterateElements() || list.Type().IsMapType() || list.Type().IsObjectType() {
+				return cty.NilVal, function.NewArgErrorf(0, "must be a list of booleans")
+			}
+
+			var values []bool
+			for it := list.ElementIterator(); it.Next(); {
+				_, value := it.Element()
+				if value.IsNull() || value.Type() != cty.Bool {
+					return cty.NilVal, function.NewArgErrorf(0, "must be a list of booleans")
+				}
+				values = append(values, value.True())
+			}
+			return cty.BoolVal(reduce(values)), nil
+		},
+	})
+}
+
+// ValidateAssertions checks that the condition of every assertion within the
+// specification is a valid HCL expression.
+func (s TestSpecification) ValidateAssertions() error {
+	for ix, assertion := range s.Assertions {
+		if _, err := assertion.parse(); err != nil {
+			return fmt.Errorf("assertion %d: %w", ix+1, err)
+		}
+	}
+	return nil
+}
+
+func (a Assertion) parse() (hclsyntax.Expression, error) {
+	if len(strings.TrimSpace(a.Condition)) == 0 {
+		return nil, fmt.Errorf("condition can't be empty")
+	}
+
+	expression, diags := hclsyntax.ParseExpression([]byte(a.Condition), "condition", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diagnosticsError(diags)
+	}
+	return expression, nil
+}
+
+// CheckAssertions evaluates every assertion in the test specification against
+// the captured output files, and returns the assertions that failed.
+//
+// The assertions are evaluated against the files exactly as they were
+// captured, before any fields are ignored or any rewrites are applied.
+func (output TestOutput) CheckAssertions() ([]AssertionFailure, error) {
+	if len(output.Test.Specification.Assertions) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(output.files))
+	for name := range output.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := map[string]cty.Value{}
+	for _, name := range names {
+		file := output.files[name]
+		if contents, ok := file.Json(); ok {
+			value, err := toCtyValue(contents)
+			if err != nil {
+				return nil, fmt.Errorf("could not convert %s for assertions: %w", name, err)
+			}
+			values[name] = value
+			continue
+		}
+		contents, _ := file.String()
+		values[name] = cty.StringVal(contents)
+	}
+
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"files": cty.ObjectVal(values),
+		},
+		Functions: assertionFunctions,
+	}
+
+	var failures []AssertionFailure
+	for _, assertion := range output.Test.Specification.Assertions {
+		expression, err := assertion.parse()
+		if err != nil {
+			return nil, err
+		}
+
+		if reason := evaluate(expression, ctx); len(reason) > 0 {
+			failures = append(failures, AssertionFailure{
+				Assertion: assertion,
+				Reason:    reason,
+			})
+		}
+	}
+	return failures, nil
+}
+
+// evaluate returns the reason the expression doesn't evaluate to true, or an
+// empty string if it does.
+func evaluate(expression hclsyntax.Expression, ctx *hcl.EvalContext) string {
+	value, diags := expression.Value(ctx)
+	if diags.HasErrors() {
+		return diagnosticsError(diags).Error()
+	}
+
+	if value.IsNull() {
+		return "condition returned null"
+	}
+	if value.Type() != cty.Bool {
+		return fmt.Sprintf("condition returned %s, expected a bool", value.Type().FriendlyName())
+	}
+	if value.False() {
+		return "condition returned false"
+	}
+	return ""
+}
+
+func toCtyValue(contents interface{}) (cty.Value, error) {
+	data, err := json.Marshal(contents)
+	if err != nil {
+		return cty.NilVal, err
+	}
+
+	ty, err := ctyjson.ImpliedType(data)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return ctyjson.Unmarshal(data, ty)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/opentofu/equivalence-testing/internal/files"
+)
+
+func TestCheckAssertions(t *testing.T) {
+	outputs := map[string]string{
+		"plan.json":  `{"resource_changes": [{"change": {"actions": ["create"]}}, {"change": {"actions": ["create"]}}, {"change": {"actions": ["update"]}}]}`,
+		"state.json": `{"values": {"outputs": {"id": {"value": "i-0123abcd"}}}}`,
+		"apply.json": `[{"type": "version"}, {"type": "change_summary", "changes": {"add": 2}}]`,
+	}
+
+	captured := map[string]*files.File{
+		"plan": files.NewRawFile("Plan: 2 to add, 1 to change, 0 to destroy."),
+	}
+	for name, contents := range outputs {
+		var data interface{}
+		if err := json.Unmarshal([]byte(contents), &data); err != nil {
+			t.Fatal(err)
+		}
+		captured[name] = files.NewJsonFile(data)
+	}
+
+	tcs := map[string]struct {
+		condition string
+		reason    string
+	}{
+		"count": {
+			condition: `length([for rc in files["plan.json"].resource_changes : rc if rc.change.actions == ["create"]]) == 2`,
+		},
+		"regex": {
+			condition: `can(regex("^i-[0-9a-f]+$", files["state.json"].values.outputs.id.value))`,
+		},
+		"event": {
+			condition: `anytrue([for event in files["apply.json"] : event.type == "change_summary" && try(event.changes.add, null) == 2])`,
+		},
+		"raw": {
+			condition: `strcontains(files.plan, "2 to add")`,
+		},
+		"false": {
+			condition: `length(files["plan.json"].resource_changes) == 2`,
+			reason:    "condition returned false",
+		},
+		"not bool": {
+			condition: `files["state.json"].values.outputs.id.value`,
+			reason:    "condition returned string, expected a bool",
+		},
+		"missing file": {
+			condition: `files["missing.json"] != null`,
+			reason:    "condition:1,6-22: Invalid index; The given key does not identify an element in this collection value.",
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			assertion := Assertion{Condition: tc.condition}
+			output := TestOutput{
+				Test: Test{
+					Specification: TestSpecification{
+						Assertions: []Assertion{assertion},
+					},
+				},
+				files: captured,
+			}
+
+			failures, err := output.CheckAssertions()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var expected []AssertionFailure
+			if len(tc.reason) > 0 {
+				expected = []AssertionFailure{{Assertion: assertion, Reason: tc.reason}}
+			}
+			if diff := cmp.Diff(expected, failures); len(diff) > 0 {
+				t.Errorf("expected:\n%v\nactual:\n%v\ndiff:\n%s", expected, failures, diff)
+			}
+		})
+	}
+}
+
+func TestValidateAssertions(t *testing.T) {
+	specification := TestSpecification{
+		Assertions: []Assertion{
+			{Condition: `length(files["plan.json"].resource_changes) == 1`},
+			{Condition: `length(files[`},
+		},
+	}
+
+	if err := specification.ValidateAssertions(); err == nil {
+		t.Errorf("expected an error for the invalid condition")
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Change is a single difference found between a golden file and the new
+// output for the same file.
+type Change struct {
+	// Path is the location of the change within the file. For JSON files this
+	// uses the same dotted syntax as the IgnoreFields specification, for raw
+	// files this references the line number in the new output.
+	Path string
+
+	// Old and New are the rendered values on either side of the change. If
+	// the value doesn't exist on one side (eg. a field was added or removed)
+	// then the relevant string will be empty and HasOld or HasNew will be
+	// false.
+	Old    string
+	New    string
+	HasOld bool
+	HasNew bool
+}
+
+func (c Change) String() string {
+	var builder strings.Builder
+	if c.HasOld {
+		builder.WriteString(fmt.Sprintf("- %s: %s\n", c.Path, c.Old))
+	}
+	if c.HasNew {
+		builder.WriteString(fmt.Sprintf("+ %s: %s\n", c.Path, c.New))
+	}
+	return builder.String()
+}
+
+// FileDiff contains the difference between a single golden file and the new
+// output for the same file.
+type FileDiff struct {
+	// Status is NewFile if there was no golden file to compare against,
+	// NoChange if the files are identical, and empty otherwise.
+	Status string
+
+	// Diff is the complete human-readable diff between the golden file and
+	// the new output.
+	Diff string
+
+	// Changes is the list of individual changes that make up Diff.
+	Changes []Change
+}
+
+func (diff FileDiff) String() string {
+	if len(diff.Status) > 0 {
+		return diff.Status
+	}
+	return diff.Diff
+}
+
+func diffJson(golden, output interface{}) FileDiff {
+	reporter := &changeReporter{}
+	if cmp.Equal(golden, output, cmp.Reporter(reporter)) {
+		return FileDiff{Status: NoChange}
+	}
+
+	return FileDiff{
+		Diff:    cmp.Diff(golden, output),
+		Changes: reporter.changes,
+	}
+}
+
+func diffRaw(golden, output string) FileDiff {
+	if golden == output {
+		return FileDiff{Status: NoChange}
+	}
+
+	// We compare the raw files line by line so that we can report each
+	// changed line as an individual change.
+	reporter := &changeReporter{raw: true}
+	cmp.Equal(strings.Split(golden, "\n"), strings.Split(output, "\n"), cmp.Reporter(reporter))
+
+	return FileDiff{
+		Diff:    cmp.Diff(golden, output),
+		Changes: reporter.changes,
+	}
+}
+
+// changeReporter implements the reporter interface from the cmp package, and
+// records every individual difference it is told about as a Change.
+type changeReporter struct {
+	raw     bool
+	path    cmp.Path
+	changes []Change
+}
+
+func (r *changeReporter) PushStep(step cmp.PathStep) {
+	r.path = append(r.path, step)
+}
+
+func (r *changeReporter) Report(result cmp.Result) {
+	if result.Equal() {
+		return
+	}
+
+	before, after := r.path.Last().Values()
+	change := Change{
+		Path:   r.renderPath(),
+		HasOld: before.IsValid(),
+		HasNew: after.IsValid(),
+	}
+	if change.HasOld {
+		change.Old = r.renderValue(before)
+	}
+	if change.HasNew {
+		change.New = r.renderValue(after)
+	}
+	r.changes = append(r.changes, change)
+}
+
+func (r *changeReporter) PopStep() {
+	r.path = r.path[:len(r.path)-1]
+}
+
+func (r *changeReporter) renderPath() string {
+	var parts []string
+	for _, step := range r.path {
+		switch step := step.(type) {
+		case cmp.MapIndex:
+			parts = append(parts, fmt.Sprint(step.Key().Interface()))
+		case cmp.SliceIndex:
+			ix := step.Key()
+			if ix < 0 {
+				// This means the element only exists on one side, so we'll
+				// report whichever index is actually valid.
+				oldIx, newIx := step.SplitKeys()
+				ix = newIx
+				if ix < 0 {
+					ix = oldIx
+				}
+			}
+
+			if r.raw {
+				parts = append(parts, fmt.Sprintf("line %d", ix+1))
+			} else {
+				parts = append(parts, fmt.Sprint(ix))
+			}
+		}
+	}
+
+	if len(parts) == 0 {
+		return "(root)"
+	}
+	return strings.Join(parts, ".")
+}
+
+func (r *changeReporter) renderValue(value reflect.Value) string {
+	if r.raw {
+		return value.Interface().(string)
+	}
+
+	data, err := json.Marshal(value.Interface())
+	if err != nil {
+		return fmt.Sprintf("%v", value.Interface())
+	}
+	return string(data)
+}
+
+// CommonPath returns the longest path prefix, in the dotted syntax used by
+// Change.Path, that is shared by every change in changes.
+func CommonPath(changes []Change) string {
+	if len(changes) == 0 {
+		return ""
+	}
+
+	common := strings.Split(changes[0].Path, ".")
+	for _, change := range changes[1:] {
+		parts := strings.Split(change.Path, ".")
+
+		ix := 0
+		for ix < len(common) && ix < len(parts) && common[ix] == parts[ix] {
+			ix++
+		}
+		common = common[:ix]
+	}
+	return strings.Join(common, ".")
+}
@@ -0,0 +1,66 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffJson(t *testing.T) {
+	golden := map[string]interface{}{
+		"values": map[string]interface{}{
+			"root_module": map[string]interface{}{
+				"resources": []interface{}{
+					map[string]interface{}{"id": "one"},
+					map[string]interface{}{"id": "two"},
+				},
+			},
+		},
+		"removed": true,
+	}
+	output := map[string]interface{}{
+		"values": map[string]interface{}{
+			"root_module": map[string]interface{}{
+				"resources": []interface{}{
+					map[string]interface{}{"id": "three"},
+					map[string]interface{}{"id": "four"},
+				},
+			},
+		},
+	}
+
+	diff := diffJson(golden, output)
+	expected := []Change{
+		{Path: "removed", Old: "true", HasOld: true},
+		{Path: "values.root_module.resources.0.id", Old: `"one"`, New: `"three"`, HasOld: true, HasNew: true},
+		{Path: "values.root_module.resources.1.id", Old: `"two"`, New: `"four"`, HasOld: true, HasNew: true},
+	}
+	if d := cmp.Diff(expected, diff.Changes); len(d) > 0 {
+		t.Errorf("unexpected changes: %s", d)
+	}
+
+	if common := CommonPath(diff.Changes[1:]); common != "values.root_module.resources" {
+		t.Errorf("expected common path values.root_module.resources but found %q", common)
+	}
+
+	if common := CommonPath(diff.Changes); common != "" {
+		t.Errorf("expected no common path but found %q", common)
+	}
+}
+
+func TestDiffRaw(t *testing.T) {
+	if diff := diffRaw("one\ntwo\n", "one\ntwo\n"); diff.Status != NoChange {
+		t.Errorf("expected no change but found %q", diff)
+	}
+
+	diff := diffRaw("one\ntwo\nthree\n", "one\n2\nthree\n")
+	expected := []Change{
+		{Path: "line 2", Old: "two", New: "2", HasOld: true, HasNew: true},
+	}
+	if d := cmp.Diff(expected, diff.Changes); len(d) > 0 {
+		t.Errorf("unexpected changes: %s", d)
+	}
+}
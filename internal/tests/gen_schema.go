@@ -0,0 +1,33 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build ignore
+
+// This program writes the JSON schema for test specifications into the file
+// given as its only argument. It is executed by `go generate`.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/opentofu/equivalence-testing/internal/tests"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: go run gen_schema.go <output>")
+		os.Exit(1)
+	}
+
+	data, err := tests.WriteSpecificationSchema()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(os.Args[1], data, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
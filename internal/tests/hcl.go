@@ -0,0 +1,315 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// hclBlock describes how a list of structs within the test specification is
+// written in HCL, as a repeated block with an optional label.
+type hclBlock struct {
+	// Type is the block type, eg. command.
+	Type string
+
+	// Label is the JSON name of the field that is set by the block label. If
+	// this is empty, the block has no label.
+	Label string
+}
+
+var (
+	// hclBlocks maps the JSON names of the fields that are written as
+	// repeated blocks in HCL to the description of the block. Every other
+	// field is written as an attribute with the same name as in JSON.
+	hclBlocks = map[string]hclBlock{
+		"commands":   {Type: "command", Label: "name"},
+		"steps":      {Type: "step"},
+		"assertions": {Type: "assertion"},
+	}
+)
+
+// ParseHCLSpecification parses a test specification written in HCL.
+//
+// The HCL format mirrors the JSON format, except that commands, steps and
+// assertions are written as repeated `command "name" {}`, `step {}` and
+// `assertion {}` blocks. The value of each attribute is validated against the
+// same schema as the JSON format. Any errors include the position within the
+// HCL source.
+func ParseHCLSpecification(data []byte, filename string) (TestSpecification, error) {
+	var specification TestSpecification
+
+	file, diags := hclparse.NewParser().ParseHCL(data, filename)
+	if diags.HasErrors() {
+		return specification, diagnosticsError(diags)
+	}
+
+	if diags := decodeHCLBody(file.Body, reflect.ValueOf(&specification).Elem(), ""); diags.HasErrors() {
+		return specification, diagnosticsError(diags)
+	}
+	return specification, nil
+}
+
+// diagnosticsError converts the errors within diags into a single error that
+// lists every one of them, rather than just the first.
+func diagnosticsError(diags hcl.Diagnostics) error {
+	var messages []string
+	for _, diag := range diags.Errs() {
+		messages = append(messages, diag.Error())
+	}
+	return errors.New(strings.Join(messages, "\n"))
+}
+
+// WriteHCLSpecification writes the test specification in the HCL format read
+// by ParseHCLSpecification. Fields that are not set are left out.
+func WriteHCLSpecification(specification TestSpecification) ([]byte, error) {
+	file := hclwrite.NewEmptyFile()
+	if err := encodeHCLBody(file.Body(), reflect.ValueOf(specification), ""); err != nil {
+		return nil, err
+	}
+	return file.Bytes(), nil
+}
+
+func jsonName(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("json"), ",")[0]
+}
+
+func decodeHCLBody(body hcl.Body, target reflect.Value, label string) hcl.Diagnostics {
+	fields := map[string]reflect.Value{}
+	blocks := map[string]string{}
+
+	schema := &hcl.BodySchema{}
+	for ix := 0; ix < target.NumField(); ix++ {
+		name := jsonName(target.Type().Field(ix))
+		if len(name) == 0 || name == "-" || name == label {
+			continue
+		}
+
+		fields[name] = target.Field(ix)
+		if block, ok := hclBlocks[name]; ok {
+			var labels []string
+			if len(block.Label) > 0 {
+				labels = []string{block.Label}
+			}
+			schema.Blocks = append(schema.Blocks, hcl.BlockHeaderSchema{
+				Type:       block.Type,
+				LabelNames: labels,
+			})
+			blocks[block.Type] = name
+			continue
+		}
+		schema.Attributes = append(schema.Attributes, hcl.AttributeSchema{
+			Name: name,
+		})
+	}
+
+	content, diags := body.Content(schema)
+
+	// We decode the attributes in the order they are written, so any errors
+	// are reported in a stable order.
+	var attributes []*hcl.Attribute
+	for _, attribute := range content.Attributes {
+		attributes = append(attributes, attribute)
+	}
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i].Range.Start.Byte < attributes[j].Range.Start.Byte
+	})
+
+	for _, attribute := range attributes {
+		name := attribute.Name
+		value, valueDiags := attribute.Expr.Value(nil)
+		diags = append(diags, valueDiags...)
+		if valueDiags.HasErrors() {
+			continue
+		}
+
+		// We convert the value into JSON, and then let the JSON decoder set
+		// the field so the types are interpreted exactly as they would be in
+		// a spec.json file. The JSON is checked against the schema first, as
+		// the decoder silently ignores unknown fields in nested objects.
+		data, err := expressionJson(attribute.Expr, value)
+		if err == nil {
+			var generic interface{}
+			if err = json.Unmarshal(data, &generic); err == nil {
+				if errs := schemaFor(fields[name].Type()).validate(generic, name); len(errs) > 0 {
+					for _, err := range errs {
+						diags = append(diags, &hcl.Diagnostic{
+							Severity: hcl.DiagError,
+							Summary:  "Invalid value",
+							Detail:   fmt.Sprintf("Invalid value for %v.", err),
+							Subject:  attribute.Expr.Range().Ptr(),
+						})
+					}
+					continue
+				}
+				err = json.Unmarshal(data, fields[name].Addr().Interface())
+			}
+		}
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid value",
+				Detail:   fmt.Sprintf("Invalid value for %q: %v.", name, err),
+				Subject:  attribute.Expr.Range().Ptr(),
+			})
+		}
+	}
+
+	for _, block := range content.Blocks {
+		field := fields[blocks[block.Type]]
+
+		element := reflect.New(field.Type().Elem()).Elem()
+		if blockLabel := hclBlocks[blocks[block.Type]].Label; len(blockLabel) > 0 {
+			for ix := 0; ix < element.NumField(); ix++ {
+				if jsonName(element.Type().Field(ix)) == blockLabel {
+					element.Field(ix).SetString(block.Labels[0])
+				}
+			}
+			diags = append(diags, decodeHCLBody(block.Body, element, blockLabel)...)
+		} else {
+			diags = append(diags, decodeHCLBody(block.Body, element, "")...)
+		}
+
+		field.Set(reflect.Append(field, element))
+	}
+
+	return diags
+}
+
+// expressionJson converts value, the result of evaluating expr, into JSON.
+//
+// cty objects sort their attributes, so objects that are written out in the
+// HCL source are converted key by key instead. This keeps the keys in the
+// order they were written, which matters for fields such as rewrites.
+func expressionJson(expr hcl.Expression, value cty.Value) ([]byte, error) {
+	switch expr := expr.(type) {
+	case *hclsyntax.ObjectConsExpr:
+		var buffer bytes.Buffer
+		buffer.WriteByte('{')
+		for ix, item := range expr.Items {
+			key, diags := item.KeyExpr.Value(nil)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+
+			// The expression has already been evaluated successfully, so the
+			// key must be a known string.
+			key, err := convert.Convert(key, cty.String)
+			if err != nil {
+				return nil, err
+			}
+
+			name, err := json.Marshal(key.AsString())
+			if err != nil {
+				return nil, err
+			}
+
+			child, err := expressionJson(item.ValueExpr, value.GetAttr(key.AsString()))
+			if err != nil {
+				return nil, err
+			}
+
+			if ix > 0 {
+				buffer.WriteByte(',')
+			}
+			buffer.Write(name)
+			buffer.WriteByte(':')
+			buffer.Write(child)
+		}
+		buffer.WriteByte('}')
+		return buffer.Bytes(), nil
+	case *hclsyntax.TupleConsExpr:
+		var buffer bytes.Buffer
+		buffer.WriteByte('[')
+		for ix, item := range expr.Exprs {
+			child, err := expressionJson(item, value.Index(cty.NumberIntVal(int64(ix))))
+			if err != nil {
+				return nil, err
+			}
+
+			if ix > 0 {
+				buffer.WriteByte(',')
+			}
+			buffer.Write(child)
+		}
+		buffer.WriteByte(']')
+		return buffer.Bytes(), nil
+	default:
+		return ctyjson.Marshal(value, value.Type())
+	}
+}
+
+func encodeHCLBody(body *hclwrite.Body, source reflect.Value, label string) error {
+	type pending struct {
+		block hclBlock
+		value reflect.Value
+	}
+	var blocks []pending
+
+	for ix := 0; ix < source.NumField(); ix++ {
+		name := jsonName(source.Type().Field(ix))
+		if len(name) == 0 || name == "-" || name == label {
+			continue
+		}
+
+		value := source.Field(ix)
+		if value.IsZero() {
+			continue
+		}
+
+		if block, ok := hclBlocks[name]; ok {
+			blocks = append(blocks, pending{block: block, value: value})
+			continue
+		}
+
+		data, err := json.Marshal(value.Interface())
+		if err != nil {
+			return err
+		}
+		ty, err := ctyjson.ImpliedType(data)
+		if err != nil {
+			return err
+		}
+		converted, err := ctyjson.Unmarshal(data, ty)
+		if err != nil {
+			return err
+		}
+		body.SetAttributeValue(name, converted)
+	}
+
+	for _, pending := range blocks {
+		for ix := 0; ix < pending.value.Len(); ix++ {
+			element := pending.value.Index(ix)
+
+			var labels []string
+			if len(pending.block.Label) > 0 {
+				for fx := 0; fx < element.NumField(); fx++ {
+					if jsonName(element.Type().Field(fx)) == pending.block.Label {
+						labels = []string{element.Field(fx).String()}
+					}
+				}
+			}
+
+			body.AppendNewline()
+			block := body.AppendNewBlock(pending.block.Type, labels)
+			if err := encodeHCLBody(block.Body(), element, pending.block.Label); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/opentofu/equivalence-testing/internal/binary"
+)
+
+func TestParseHCLSpecification(t *testing.T) {
+	source := `
+include_files = ["plan.json"]
+variables = {
+  name  = "value"
+  count = 2
+}
+timeout = "5m"
+
+# The rewrites are applied in the order they are written, not sorted.
+rewrites = {
+  plan = {
+    "Terraform" = "OpenTF"
+    "OpenTF"    = "OpenTofu"
+  }
+}
+
+command "plan" {
+  arguments      = ["plan", "-out={{.PlanFile}}"]
+  capture_output = true
+  retries        = 1
+}
+
+step {
+  directory = "add"
+}
+
+step {
+  remove_files = ["main.tf"]
+
+  command "apply" {
+    arguments = ["apply"]
+  }
+}
+`
+
+	expected := TestSpecification{
+		IncludeFiles: []string{"plan.json"},
+		Variables: map[string]interface{}{
+			"name":  "value",
+			"count": float64(2),
+		},
+		Timeout: binary.Duration(5 * time.Minute),
+		Rewrites: map[string]Rewrites{
+			"plan": {
+				{From: "Terraform", To: "OpenTF"},
+				{From: "OpenTF", To: "OpenTofu"},
+			},
+		},
+		Commands: []binary.Command{
+			{Name: "plan", Arguments: []string{"plan", "-out={{.PlanFile}}"}, CaptureOutput: true, Retries: 1},
+		},
+		Steps: []TestStep{
+			{Directory: "add"},
+			{RemoveFiles: []string{"main.tf"}, Commands: []binary.Command{{Name: "apply", Arguments: []string{"apply"}}}},
+		},
+	}
+
+	actual, err := ParseHCLSpecification([]byte(source), "spec.hcl")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(expected, actual); len(diff) > 0 {
+		t.Errorf("expected:\n%+v\nactual:\n%+v\ndiff:\n%s", expected, actual, diff)
+	}
+
+	written, err := WriteHCLSpecification(actual)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	roundTrip, err := ParseHCLSpecification(written, "spec.hcl")
+	if err != nil {
+		t.Fatalf("unexpected error reading written specification: %v\n%s", err, written)
+	}
+	if diff := cmp.Diff(expected, roundTrip); len(diff) > 0 {
+		t.Errorf("round trip changed the specification:\n%s", diff)
+	}
+}
+
+func TestParseHCLSpecificationErrors(t *testing.T) {
+	source := `
+timeout = 5
+
+command "plan" {
+  retries = "one"
+}
+`
+
+	_, err := ParseHCLSpecification([]byte(source), "spec.hcl")
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	for _, expected := range []string{"spec.hcl:2,11-12", "spec.hcl:5,13-18"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to contain %q, got:\n%s", expected, err)
+		}
+	}
+}
+
+func TestParseHCLSpecificationSchemaErrors(t *testing.T) {
+	source := `
+rewrites = {
+  "plan" = [{ form = "Plan", to = "Changes" }]
+}
+
+ignore_lines = {
+  "plan" = [{ match = "x", descripton = "y" }]
+}
+
+command "plan" {
+  env = { TF_LOG = 1 }
+}
+`
+
+	_, err := ParseHCLSpecification([]byte(source), "spec.hcl")
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	for _, expected := range []string{
+		`rewrites.plan[0]: unknown field "form"`,
+		`ignore_lines.plan[0]: unknown field "descripton"`,
+		`env.TF_LOG: expected string, found integer`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to contain %q, got:\n%s", expected, err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LineFilter removes lines from a raw (non-JSON) output file before it is
+// compared with or written into the golden files.
+//
+// A filter either sets Match, to remove every line that matches it, or sets
+// Start, to remove whole blocks of lines. A block starts with a line that
+// matches Start, and finishes with the next line that matches End. Both of
+// these lines are removed along with everything between them. If End is
+// empty, or never matches, the block continues until the end of the file.
+type LineFilter struct {
+	Match string `json:"match,omitempty"`
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+
+	// Description explains why the lines are removed.
+	Description string `json:"description,omitempty"`
+}
+
+func (f LineFilter) String() string {
+	var value string
+	if len(f.Match) > 0 {
+		value = fmt.Sprintf("match %q", f.Match)
+	} else {
+		value = fmt.Sprintf("start %q", f.Start)
+	}
+
+	if len(f.Description) > 0 {
+		return fmt.Sprintf("%s (%s)", value, f.Description)
+	}
+	return value
+}
+
+// compiledLineFilter is a LineFilter with its expressions compiled.
+type compiledLineFilter struct {
+	match, start, end *regexp.Regexp
+}
+
+func (f LineFilter) compile() (compiledLineFilter, error) {
+	var compiled compiledLineFilter
+
+	switch {
+	case len(f.Match) > 0 && (len(f.Start) > 0 || len(f.End) > 0):
+		return compiled, fmt.Errorf("invalid line filter %s: match can't be used with start or end", f)
+	case len(f.Match) == 0 && len(f.Start) == 0:
+		return compiled, fmt.Errorf("invalid line filter: one of match or start must be set")
+	}
+
+	var err error
+	for _, expression := range []struct {
+		value  string
+		target **regexp.Regexp
+	}{
+		{f.Match, &compiled.match},
+		{f.Start, &compiled.start},
+		{f.End, &compiled.end},
+	} {
+		if len(expression.value) == 0 {
+			continue
+		}
+		if *expression.target, err = regexp.Compile(expression.value); err != nil {
+			return compiled, fmt.Errorf("invalid line filter %s: %w", f, err)
+		}
+	}
+	return compiled, nil
+}
+
+// filterLines returns contents without any of the lines removed by filters.
+func filterLines(filters []LineFilter, contents string) (string, error) {
+	if len(filters) == 0 {
+		return contents, nil
+	}
+
+	var compiled []compiledLineFilter
+	for _, filter := range filters {
+		c, err := filter.compile()
+		if err != nil {
+			return "", err
+		}
+		compiled = append(compiled, c)
+	}
+
+	// If a block is open, this is the filter that opened it.
+	var block *compiledLineFilter
+
+	var kept []string
+	for _, line := range strings.SplitAfter(contents, "\n") {
+		if len(line) == 0 {
+			// SplitAfter returns an empty string after a trailing newline.
+			continue
+		}
+		text := strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if block != nil {
+			if block.end != nil && block.end.MatchString(text) {
+				block = nil
+			}
+			continue
+		}
+
+		removed := false
+		for ix := range compiled {
+			filter := &compiled[ix]
+			if filter.match != nil && filter.match.MatchString(text) {
+				removed = true
+				break
+			}
+			if filter.start != nil && filter.start.MatchString(text) {
+				removed = true
+				block = filter
+				break
+			}
+		}
+
+		if !removed {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, ""), nil
+}
+
+// ValidateLineFilters returns an error if any of the line filters within the
+// specification are invalid.
+func (s TestSpecification) ValidateLineFilters() error {
+	var files []string
+	for file := range s.IgnoreLines {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		for _, filter := range s.IgnoreLines[file] {
+			if _, err := filter.compile(); err != nil {
+				return fmt.Errorf("ignore_lines for %s: %w", file, err)
+			}
+		}
+	}
+	return nil
+}
+
+// mergeLineFilters returns the parent filters for each file followed by the
+// child filters, skipping any child filters that the parent already has.
+func mergeLineFilters(parent, child map[string][]LineFilter) map[string][]LineFilter {
+	if parent == nil {
+		return child
+	}
+
+	merged := map[string][]LineFilter{}
+	for file, filters := range parent {
+		merged[file] = append([]LineFilter{}, filters...)
+	}
+	for file, filters := range child {
+		for _, filter := range filters {
+			exists := false
+			for _, existing := range merged[file] {
+				if existing == filter {
+					exists = true
+					break
+				}
+			}
+			if !exists {
+				merged[file] = append(merged[file], filter)
+			}
+		}
+	}
+	return merged
+}
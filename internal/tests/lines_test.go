@@ -0,0 +1,98 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilterLines(t *testing.T) {
+	input := `Initializing the backend...
+
+Initializing provider plugins...
+- Finding latest version of hashicorp/random...
+- Installing hashicorp/random v3.5.1...
+- Installed hashicorp/random v3.5.1 (signed by HashiCorp)
+
+OpenTofu has been successfully initialized!
+
+Plan: 1 to add, 0 to change, 0 to destroy.
+
+─────────────────────────────────────────────────────────────────────────────
+
+Note: You didn't use the -out option to save this plan, so OpenTofu can't
+guarantee to take exactly these actions if you run "tofu apply" now.
+`
+
+	tcs := map[string]struct {
+		filters  []LineFilter
+		expected string
+	}{
+		"none": {
+			expected: input,
+		},
+		"match": {
+			filters: []LineFilter{
+				{Match: `^- (Finding|Installing|Installed) `},
+			},
+			expected: `Initializing the backend...
+
+Initializing provider plugins...
+
+OpenTofu has been successfully initialized!
+
+Plan: 1 to add, 0 to change, 0 to destroy.
+
+─────────────────────────────────────────────────────────────────────────────
+
+Note: You didn't use the -out option to save this plan, so OpenTofu can't
+guarantee to take exactly these actions if you run "tofu apply" now.
+`,
+		},
+		"blocks": {
+			filters: []LineFilter{
+				{Start: `^Initializing provider plugins`, End: `^$`},
+				{Start: `^─+$`},
+			},
+			expected: `Initializing the backend...
+
+OpenTofu has been successfully initialized!
+
+Plan: 1 to add, 0 to change, 0 to destroy.
+
+`,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			actual, err := filterLines(tc.filters, input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expected, actual); len(diff) > 0 {
+				t.Errorf("unexpected output:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateLineFilters(t *testing.T) {
+	for name, filter := range map[string]LineFilter{
+		"empty":           {},
+		"match and start": {Match: "a", Start: "b"},
+		"end only":        {End: "b"},
+		"invalid":         {Match: "("},
+	} {
+		t.Run(name, func(t *testing.T) {
+			specification := TestSpecification{
+				IgnoreLines: map[string][]LineFilter{"plan": {filter}},
+			}
+			if err := specification.ValidateLineFilters(); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// builtinNormalizers are the patterns used by normalizers that only
+	// specify a name.
+	builtinNormalizers = map[string]string{
+		"uuid":      `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+		"timestamp": `[0-9]{4}-[0-9]{2}-[0-9]{2}[Tt][0-9]{2}:[0-9]{2}:[0-9]{2}(?:\.[0-9]+)?(?:[Zz]|[+-][0-9]{2}:[0-9]{2})`,
+		"hex":       `\b[0-9a-f]{16,}\b`,
+	}
+
+	normalizerName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+)
+
+// Normalizer replaces the values that match a pattern with a token that is
+// stable across every output file of a test. Each distinct value is given
+// its own ordinal, so the first value matched is replaced with <name-1>, the
+// second distinct value with <name-2>, and any repeats of a value are
+// replaced with the same token.
+//
+// This means the golden files still record which values are the same, eg.
+// a resource that references the ID of another resource, without recording
+// the values themselves.
+type Normalizer struct {
+	// Name is used in the tokens, eg. <uuid-1>. The names uuid, timestamp and
+	// hex have builtin patterns.
+	Name string `json:"name"`
+
+	// Pattern is the regular expression that matches the values to replace.
+	// This can be empty if the name has a builtin pattern.
+	Pattern string `json:"pattern,omitempty"`
+}
+
+func (n Normalizer) pattern() (string, error) {
+	if !normalizerName.MatchString(n.Name) {
+		return "", fmt.Errorf("invalid normalizer name %q: names must start with a letter and only contain letters, digits and underscores", n.Name)
+	}
+
+	if len(n.Pattern) > 0 {
+		if _, err := regexp.Compile(n.Pattern); err != nil {
+			return "", fmt.Errorf("invalid pattern for normalizer %q: %w", n.Name, err)
+		}
+		return n.Pattern, nil
+	}
+
+	if pattern, ok := builtinNormalizers[n.Name]; ok {
+		return pattern, nil
+	}
+
+	var builtins []string
+	for name := range builtinNormalizers {
+		builtins = append(builtins, name)
+	}
+	sort.Strings(builtins)
+	return "", fmt.Errorf("normalizer %q must specify a pattern, only %s have builtin patterns", n.Name, strings.Join(builtins, ", "))
+}
+
+// ValidateNormalizers checks that every normalizer within the specification
+// has a valid name and pattern.
+func (s TestSpecification) ValidateNormalizers() error {
+	_, err := newNormalizer(s.Normalize)
+	return err
+}
+
+// normalizer holds the tokens assigned to values while normalizing the output
+// files of a single test.
+type normalizer struct {
+	// names are the normalizer names, in the order of the capture groups of
+	// the expression.
+	names      []string
+	expression *regexp.Regexp
+
+	tokens map[string]map[string]string
+}
+
+// newNormalizer returns a normalizer for the given configuration, or nil if
+// no normalizers are configured.
+//
+// Where the patterns of multiple normalizers match at the same position, the
+// normalizer listed first wins.
+func newNormalizer(normalizers []Normalizer) (*normalizer, error) {
+	if len(normalizers) == 0 {
+		return nil, nil
+	}
+
+	n := &normalizer{
+		tokens: map[string]map[string]string{},
+	}
+
+	var groups []string
+	for ix, config := range normalizers {
+		pattern, err := config.pattern()
+		if err != nil {
+			return nil, err
+		}
+
+		n.names = append(n.names, config.Name)
+		groups = append(groups, fmt.Sprintf("(?P<n%d>%s)", ix, pattern))
+	}
+
+	var err error
+	if n.expression, err = regexp.Compile(strings.Join(groups, "|")); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// normalizeString replaces every matching value in value with its token.
+func (n *normalizer) normalizeString(value string) string {
+	matches := n.expression.FindAllStringSubmatchIndex(value, -1)
+	if len(matches) == 0 {
+		return value
+	}
+
+	var builder strings.Builder
+	last := 0
+	for _, match := range matches {
+		if match[0] == match[1] {
+			// Skip empty matches, they have nothing to replace.
+			continue
+		}
+
+		for ix, name := range n.names {
+			group := n.expression.SubexpIndex(fmt.Sprintf("n%d", ix))
+			if match[2*group] < 0 {
+				continue
+			}
+
+			builder.WriteString(value[last:match[0]])
+			builder.WriteString(n.token(name, value[match[0]:match[1]]))
+			last = match[1]
+			break
+		}
+	}
+	builder.WriteString(value[last:])
+	return builder.String()
+}
+
+// normalizeJson replaces every matching value within the strings and object
+// keys of the JSON value with its token. Object keys are visited in sorted
+// order, which is the order they are written into the golden files, so the
+// tokens are assigned in the order they appear. Each key is normalized before
+// the value beneath it.
+func (n *normalizer) normalizeJson(value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		return n.normalizeString(value)
+	case []interface{}:
+		for ix, item := range value {
+			value[ix] = n.normalizeJson(item)
+		}
+		return value
+	case map[string]interface{}:
+		var keys []string
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		ret := make(map[string]interface{}, len(value))
+		for _, key := range keys {
+			normalized := n.normalizeString(key)
+			ret[normalized] = n.normalizeJson(value[key])
+		}
+		return ret
+	default:
+		return value
+	}
+}
+
+func (n *normalizer) token(name, value string) string {
+	tokens, ok := n.tokens[name]
+	if !ok {
+		tokens = map[string]string{}
+		n.tokens[name] = tokens
+	}
+
+	if token, ok := tokens[value]; ok {
+		return token
+	}
+
+	token := fmt.Sprintf("<%s-%d>", name, len(tokens)+1)
+	tokens[value] = token
+	return token
+}
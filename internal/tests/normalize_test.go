@@ -0,0 +1,103 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/opentofu/equivalence-testing/internal/files"
+)
+
+func TestFilesNormalize(t *testing.T) {
+	output := TestOutput{
+		Test: Test{
+			Specification: TestSpecification{
+				Normalize: []Normalizer{
+					{Name: "uuid"},
+					{Name: "timestamp"},
+					{Name: "instance", Pattern: `i-[0-9a-f]{8}`},
+				},
+			},
+		},
+		files: map[string]*files.File{
+			"a.json": jsonFile(t, `{
+  "id": "d199d8ea-e8f8-4fb0-8276-3567a74d3db8",
+  "other": "192977d6-b169-4170-a9d4-ee1dcef7c6ea",
+  "created": "2023-09-01T10:00:00Z",
+  "instance": "i-0123abcd"
+}`),
+			"b.json": jsonFile(t, `{
+  "reference": "d199d8ea-e8f8-4fb0-8276-3567a74d3db8",
+  "list": ["prefix/192977d6-b169-4170-a9d4-ee1dcef7c6ea/suffix", "2023-09-01T10:00:05.123+01:00"],
+  "resources": {
+    "d199d8ea-e8f8-4fb0-8276-3567a74d3db8": {"name": "one"},
+    "3f2504e0-4f89-11d3-9a0c-0305e82c3301": {"name": "two"}
+  }
+}`),
+			"plan": files.NewRawFile("instance i-0123abcd (d199d8ea-e8f8-4fb0-8276-3567a74d3db8) and i-89abcdef"),
+		},
+	}
+
+	expected := map[string]string{
+		"a.json": `{"created":"<timestamp-1>","id":"<uuid-1>","instance":"<instance-1>","other":"<uuid-2>"}`,
+		"b.json": `{"list":["prefix/<uuid-2>/suffix","<timestamp-2>"],"reference":"<uuid-1>","resources":{"<uuid-1>":{"name":"one"},"<uuid-3>":{"name":"two"}}}`,
+		"plan":   `instance <instance-1> (<uuid-1>) and <instance-2>`,
+	}
+
+	// We check twice, to make sure the tokens are the same every time and the
+	// captured files aren't modified.
+	for attempt := 0; attempt < 2; attempt++ {
+		actual, err := output.Files()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		rendered := map[string]string{}
+		for name, file := range actual {
+			if contents, ok := file.Json(); ok {
+				var buffer bytes.Buffer
+				encoder := json.NewEncoder(&buffer)
+				encoder.SetEscapeHTML(false)
+				if err := encoder.Encode(contents); err != nil {
+					t.Fatal(err)
+				}
+				rendered[name] = strings.TrimSpace(buffer.String())
+				continue
+			}
+			rendered[name], _ = file.String()
+		}
+
+		if diff := cmp.Diff(expected, rendered); len(diff) > 0 {
+			t.Errorf("attempt %d: unexpected files:\n%s", attempt+1, diff)
+		}
+	}
+}
+
+func TestValidateNormalizers(t *testing.T) {
+	for name, normalizer := range map[string]Normalizer{
+		"unknown builtin": {Name: "arn"},
+		"invalid name":    {Name: "my-id", Pattern: "x"},
+		"invalid pattern": {Name: "id", Pattern: "("},
+	} {
+		t.Run(name, func(t *testing.T) {
+			specification := TestSpecification{Normalize: []Normalizer{normalizer}}
+			if err := specification.ValidateNormalizers(); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func jsonFile(t *testing.T, contents string) *files.File {
+	var data interface{}
+	if err := json.Unmarshal([]byte(contents), &data); err != nil {
+		t.Fatal(err)
+	}
+	return files.NewJsonFile(data)
+}
@@ -4,15 +4,15 @@
 package tests
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
-
-	"github.com/google/go-cmp/cmp"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/opentofu/equivalence-testing/internal/files"
 	strip "github.com/opentofu/equivalence-testing/internal/json"
@@ -24,6 +24,8 @@ const (
 )
 
 var (
+	stepPrefix = regexp.MustCompile(`^step_[0-9]+/`)
+
 	// defaultFields is the set of fields that are ignored by default for any
 	// files by the given names.
 	defaultFields = map[string][]string{
@@ -48,45 +50,223 @@ var (
 // The Files function will return these JSON objects, pre-stripped of any
 // unwanted JSON fields.
 type TestOutput struct {
-	Test  Test
+	Test Test
+
+	// Flavor and Version describe the binary that produced this output, and
+	// are used to select the golden variant to compare against.
+	Flavor  string
+	Version string
+
 	files map[string]*files.File
+
+	// processed caches the processed and rendered files, so the captured
+	// outputs, which can be huge, are only processed once however many of
+	// the methods below are called. It is shared between copies of the
+	// TestOutput, and outputs that weren't created by RunWith don't cache
+	// anything.
+	processed *processedOutput
+}
+
+// processedOutput holds the files of a TestOutput after they have been
+// processed and rendered, along with the matches for every rule.
+type processedOutput struct {
+	once sync.Once
+
+	files    map[string]*files.File
+	warnings []string
+	err      error
+
+	// rendered holds the bytes of each file as they are written into the
+	// golden files directory. renderErr is kept apart from err, so a file
+	// that can't be rendered doesn't stop the other files being inspected.
+	rendered  map[string][]byte
+	renderErr error
+
+	hits *ruleHits
 }
 
-// Files returns the JSON files that were returned by the test stripped of any
-// unwanted fields.
+// results processes and renders the files, or returns the cached results if
+// that has already happened.
+func (output TestOutput) results() *processedOutput {
+	processed := output.processed
+	if processed == nil {
+		processed = &processedOutput{}
+	}
+
+	processed.once.Do(func() {
+		processed.hits = newRuleHits()
+		processed.files, processed.warnings, processed.err = output.process(processed.hits)
+		if processed.err != nil {
+			return
+		}
+
+		var names []string
+		for name := range processed.files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		processed.rendered = map[string][]byte{}
+		for _, name := range names {
+			data, err := output.render(name, processed.files[name], processed.hits)
+			if err != nil {
+				processed.renderErr = err
+				return
+			}
+			processed.rendered[name] = data
+		}
+	})
+	return processed
+}
+
+// GoldenDirectory returns the directory, within goldens, that holds the golden
+// files for this output.
+//
+// This is the golden directory for the test, or one of its variant
+// subdirectories if any of them match the binary that produced the output.
+func (output TestOutput) GoldenDirectory(goldens string) (string, error) {
+	directory := path.Join(goldens, output.Test.Name)
+
+	variant, err := SelectVariant(directory, output.Flavor, output.Version)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(directory, variant), nil
+}
+
+// Files returns the files that were returned by the test, with any unwanted
+// lines removed from raw files. JSON files are stripped of any unwanted
+// fields, and returned with the values of any masked fields replaced by
+// placeholders. Then any rewrites that target JSON paths are applied, and
+// finally any values matched by the normalizers are replaced with their
+// tokens in every file.
+//
+// The files captured by the test are not modified.
 func (output TestOutput) Files() (map[string]*files.File, error) {
+	processed := output.results()
+	return processed.files, processed.err
+}
+
+// Warnings returns any problems with the fields and paths in the test
+// specification that didn't stop the output files being processed, such as
+// an array index that is out of range for the captured data.
+func (output TestOutput) Warnings() ([]string, error) {
+	processed := output.results()
+	return processed.warnings, processed.err
+}
+
+// process implements Files, and also returns the warnings reported while
+// processing the files. If hits isn't nil, the matches for each of the
+// ignore_fields and the rewrites that target JSON paths are added into it.
+func (output TestOutput) process(hits *ruleHits) (map[string]*files.File, []string, error) {
+	normalizer, err := newNormalizer(output.Test.Specification.Normalize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// We process the files in order, so the normalizers assign the same
+	// tokens every time.
+	var names []string
+	for name := range output.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var warnings []string
 	ret := map[string]*files.File{}
-	for name, file := range output.files {
+	for _, name := range names {
+		file := output.files[name]
+
 		contents, ok := file.Json()
 		if !ok {
-			ret[name] = file
+			var filters []LineFilter
+			for _, key := range ruleNames(name) {
+				filters = append(filters, output.Test.Specification.IgnoreLines[key]...)
+			}
+
+			raw, _ := file.String()
+			filtered, err := filterLines(filters, raw)
+			if err != nil {
+				return nil, nil, fmt.Errorf("file %q: %w", name, err)
+			}
+
+			if normalizer != nil {
+				filtered = normalizer.normalizeString(filtered)
+			}
+			ret[name] = files.NewRawFile(filtered)
 			continue
 		}
 
-		var ignoreFields []string
-		ignoreFields = append(ignoreFields, defaultFields[name]...)
-		ignoreFields = append(ignoreFields, output.Test.Specification.IgnoreFields[name]...)
+		var report strip.Report
+		stripped := strip.Copy(contents)
+
+		var maskFields []string
+		for _, key := range ruleNames(name) {
+			stripped, err = report.Strip(defaultFields[key], stripped)
+			if err != nil {
+				return nil, nil, err
+			}
 
-		stripped, err := strip.Strip(ignoreFields, contents)
+			// The fields for each key are stripped with their own report, so
+			// the hits are recorded against the key they were listed under.
+			var fieldReport strip.Report
+			stripped, err = fieldReport.Strip(output.Test.Specification.IgnoreFields[key], stripped)
+			if err != nil {
+				return nil, nil, err
+			}
+			report.Warnings = append(report.Warnings, fieldReport.Warnings...)
+			hits.addFields(key, fieldReport.Hits)
+
+			maskFields = append(maskFields, output.Test.Specification.MaskFields[key]...)
+		}
+
+		masked, err := report.Mask(maskFields, stripped)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+
+		rewrites, ids := output.rewrites(name)
+		if masked, err = rewrites.applyJson(&report, hits.rewriteHits(ids), masked); err != nil {
+			return nil, nil, fmt.Errorf("file %q: %w", name, err)
+		}
+
+		if normalizer != nil {
+			masked = normalizer.normalizeJson(masked)
+		}
+		ret[name] = file.WithJson(masked)
+
+		for _, warning := range report.Warnings {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", name, warning))
 		}
-		ret[name] = files.NewJsonFile(stripped)
 	}
-	return ret, nil
+	return ret, warnings, nil
 }
 
 // ComputeDiff will report the difference between this TestOutput and the output
-// already stored in the golden directory specified by the parameter.
-func (output TestOutput) ComputeDiff(goldens string) (map[string]string, error) {
-	newFiles, err := output.Files()
+// already stored in the golden directory specified by the parameter. The most
+// specific golden variant that matches the binary is used, see
+// GoldenDirectory.
+//
+// The new output is rendered exactly as it would be written by
+// UpdateGoldenFiles, so any rewrites are applied before the comparison is
+// made.
+func (output TestOutput) ComputeDiff(goldens string) (map[string]FileDiff, error) {
+	processed := output.results()
+	if processed.err != nil {
+		return nil, processed.err
+	}
+	if processed.renderErr != nil {
+		return nil, processed.renderErr
+	}
+
+	directory, err := output.GoldenDirectory(goldens)
 	if err != nil {
 		return nil, err
 	}
 
-	ret := map[string]string{}
-	for name, newFile := range newFiles {
-		target := path.Join(goldens, output.Test.Name, name)
+	ret := map[string]FileDiff{}
+	for name, newFile := range processed.files {
+		target := path.Join(directory, name)
 
 		goldenFile, err := os.ReadFile(target)
 		if err != nil {
@@ -99,44 +279,162 @@ func (output TestOutput) ComputeDiff(goldens string) (map[string]string, error)
 			// Then this means we don't have a golden file for this yet (as in
 			// this is the first time we are using it). Let's just pretend it
 			// was empty.
-			ret[name] = NewFile
+			ret[name] = FileDiff{Status: NewFile}
 			continue
 		}
 
-		var diff string
+		data := processed.rendered[name]
+
 		switch newFile.Ext() {
 		case files.Json:
-			// Then we can marshal the goldenFile into a JSON struct and get
-			// more interesting output.
-			newFileJson, _ := newFile.Json()
-			var oldFileJson interface{}
-			if err := json.Unmarshal(goldenFile, &oldFileJson); err != nil {
-				return nil, err
+			// Then we can decode both files into JSON structs and get more
+			// interesting output.
+			codec := newFile.Codec()
+			oldFileJson, err := codec.Decode(goldenFile)
+			if err != nil {
+				return nil, fmt.Errorf("golden file %q is not valid %s: %w", name, strings.ToUpper(codec.Name()), err)
 			}
-			diff = cmp.Diff(oldFileJson, newFileJson)
+			newFileJson, err := codec.Decode(data)
+			if err != nil {
+				return nil, fmt.Errorf("rewritten file %q is not valid %s: %w", name, strings.ToUpper(codec.Name()), err)
+			}
+			ret[name] = diffJson(oldFileJson, newFileJson)
 		case files.Raw:
 			// Then we're just going to do a string comparison between the
 			// goldenFile bytes and newFile.
-			newFileString, _ := newFile.String()
-			diff = cmp.Diff(string(goldenFile), newFileString)
+			ret[name] = diffRaw(string(goldenFile), string(data))
 		default:
 			return nil, errors.New("found unrecognized file type: " + newFile.Ext())
 		}
+	}
+	return ret, nil
+}
+
+// render converts a single output file into the bytes that should be written
+// into the golden files directory, applying any rewrites along the way. If
+// hits isn't nil, the matches for each rewrite are added into it.
+func (output TestOutput) render(name string, file *files.File, hits *ruleHits) ([]byte, error) {
+	var data []byte
+	switch file.Ext() {
+	case files.Json:
+		contents, _ := file.Json()
 
-		if len(diff) == 0 {
-			ret[name] = NoChange
-		} else {
-			ret[name] = diff
+		var err error
+		if data, err = file.Codec().Encode(contents); err != nil {
+			return nil, fmt.Errorf("file %q: %w", name, err)
 		}
+	case files.Raw:
+		contents, _ := file.String()
+		data = []byte(contents)
 	}
-	return ret, nil
+
+	rewrites, ids := output.rewrites(name)
+	data, err := rewrites.apply(hits.rewriteHits(ids), data)
+	if err != nil {
+		return nil, fmt.Errorf("file %q: %w", name, err)
+	}
+
+	if file.Ext() == files.Json {
+		if _, err := file.Codec().Decode(data); err != nil {
+			return nil, fmt.Errorf("the rewrites for file %q produced invalid %s, use rewrites with a path to change structured values safely", name, strings.ToUpper(file.Codec().Name()))
+		}
+	}
+	return data, nil
+}
+
+// rewrites returns the rewrites that apply to the named output file, in the
+// order they should be applied.
+//
+// The rewrites from the specification are applied first, followed by the
+// global rewrites, except for any global rewrite that has the same From and
+// Path as one of the rewrites from the specification.
+//
+// The IDs of the rules each rewrite came from are returned as well, so the
+// matches can be counted against them. A rewrite from the specification that
+// overrides a global rewrite counts its matches for both rules.
+func (output TestOutput) rewrites(name string) (Rewrites, [][]rewriteID) {
+	local, localIDs := matchingRewrites(output.Test.Specification.Rewrites, false, name)
+
+	rewrites := append(Rewrites{}, local...)
+	var ids [][]rewriteID
+	for _, id := range localIDs {
+		ids = append(ids, []rewriteID{id})
+	}
+
+	globals, globalIDs := matchingRewrites(output.Test.Specification.GlobalRewrites, true, name)
+	for ix, global := range globals {
+		overridden := false
+		for jx, rewrite := range local {
+			if rewrite.sameAs(global) {
+				ids[jx] = append(ids[jx], globalIDs[ix])
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			rewrites = append(rewrites, global)
+			ids = append(ids, []rewriteID{globalIDs[ix]})
+		}
+	}
+	return rewrites, ids
+}
+
+// matchingRewrites returns the rewrites that apply to the named output file,
+// and the ID of each of them.
+//
+// The rewrites are keyed by file name or glob pattern (eg. *.json or
+// step_*/plan). For each of the ruleNames of the file, the matching keys are
+// applied in sorted order.
+func matchingRewrites(rewrites map[string]Rewrites, global bool, name string) (Rewrites, []rewriteID) {
+	var keys []string
+	for key := range rewrites {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var ret Rewrites
+	var ids []rewriteID
+	for _, ruleName := range ruleNames(name) {
+		for _, key := range keys {
+			// We've already validated the patterns, so we can ignore the
+			// error.
+			if matched, _ := path.Match(key, ruleName); matched {
+				ret = append(ret, rewrites[key]...)
+				for ix := range rewrites[key] {
+					ids = append(ids, rewriteID{global: global, key: key, index: ix})
+				}
+			}
+		}
+	}
+	return ret, ids
+}
+
+// ruleNames returns the file names that the ignore fields and rewrites for the
+// named output file are listed under.
+//
+// For outputs of a multi-step test (eg. step_1/plan.json) the rules for the
+// file name without the step directory (eg. plan.json) apply as well as any
+// rules that target the output of the specific step.
+func ruleNames(name string) []string {
+	if prefix := stepPrefix.FindString(name); len(prefix) > 0 {
+		return []string{strings.TrimPrefix(name, prefix), name}
+	}
+	return []string{name}
 }
 
 // UpdateGoldenFiles will write out the files for a given TestOutput into a
 // target directory. This will overwrite any files already in the target
 // directory.
+//
+// The files are written into the golden variant selected by GoldenDirectory,
+// and any other variants are left alone.
 func (output TestOutput) UpdateGoldenFiles(target string) error {
-	tmp, err := os.MkdirTemp(target, output.Test.Name)
+	directory, err := output.GoldenDirectory(target)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp(target, tempName(output.Test.Name))
 	if err != nil {
 		return err
 	}
@@ -146,35 +444,17 @@ func (output TestOutput) UpdateGoldenFiles(target string) error {
 	// we don't want to delete tmp if anything goes wrong moving tmp into the
 	// original location. tmp can be used by the user to recover manually.
 
-	outputFiles, err := output.Files()
-	if err != nil {
-		return err
+	processed := output.results()
+	if processed.err != nil {
+		os.RemoveAll(tmp)
+		return processed.err
+	}
+	if processed.renderErr != nil {
+		os.RemoveAll(tmp)
+		return processed.renderErr
 	}
 
-	for name, file := range outputFiles {
-		var data []byte
-		switch file.Ext() {
-		case files.Json:
-			contents, _ := file.Json()
-			var err error
-			if data, err = json.MarshalIndent(contents, "", "  "); err != nil {
-				os.RemoveAll(tmp)
-				return err
-			}
-		case files.Raw:
-			contents, _ := file.String()
-			data = []byte(contents)
-		}
-
-		for expression, replacement := range output.Test.Specification.Rewrites[name] {
-			re, err := regexp.Compile(expression)
-			if err != nil {
-				return fmt.Errorf("invalid expression %q for file %q: %w", expression, name, err)
-			}
-
-			data = re.ReplaceAll(data, []byte(replacement))
-		}
-
+	for name, data := range processed.rendered {
 		target := path.Join(tmp, name)
 		if _, err := os.Stat(filepath.Dir(target)); os.IsNotExist(err) {
 			// This means the parent directory for the target file doesn't exist
@@ -193,7 +473,7 @@ func (output TestOutput) UpdateGoldenFiles(target string) error {
 
 	// Now we've copied all the new golden files into our temporary directory,
 	// we just need to move everything over to the original.
-	if err := os.RemoveAll(path.Join(target, output.Test.Name)); err != nil {
+	if err := removeGoldenFiles(directory); err != nil {
 		os.RemoveAll(tmp)
 		return err
 	}
@@ -204,11 +484,11 @@ func (output TestOutput) UpdateGoldenFiles(target string) error {
 	// recover the failed test case manually by moving the tmp directory over
 	// themselves.
 
-	if err := os.Mkdir(path.Join(target, output.Test.Name), os.ModePerm); err != nil {
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
 		return err
 	}
 
-	if err = filepath.WalkDir(tmp, files.CopyDir(tmp, path.Join(target, output.Test.Name), nil)); err != nil {
+	if err = filepath.WalkDir(tmp, files.CopyDir(tmp, directory, nil)); err != nil {
 		return err
 	}
 
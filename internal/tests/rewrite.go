@@ -0,0 +1,204 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	strip "github.com/opentofu/equivalence-testing/internal/json"
+)
+
+// Rewrite replaces every match of the From regular expression with To, see
+// regexp.Regexp.ReplaceAll for details.
+//
+// By default, a rewrite is applied to the file exactly as it is written into
+// the golden files. If Path is set, the rewrite is only applied to the string
+// values at that path, and beneath it, within a JSON file.
+type Rewrite struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Path        string `json:"path,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func (r Rewrite) String() string {
+	if len(r.Description) > 0 {
+		return fmt.Sprintf("%q (%s)", r.From, r.Description)
+	}
+	return fmt.Sprintf("%q", r.From)
+}
+
+// sameAs returns true if both rewrites replace the same expression in the
+// same part of a file, in which case one should override the other.
+func (r Rewrite) sameAs(other Rewrite) bool {
+	return r.From == other.From && r.Path == other.Path
+}
+
+// Rewrites is an ordered list of rewrites for a single file. The rewrites are
+// applied in order, so later rewrites see the output of earlier ones.
+//
+// Rewrites can be read from JSON as a list of Rewrite objects, or as an
+// object mapping each From to its To. In the second form, the rewrites are
+// applied in the order they are written.
+type Rewrites []Rewrite
+
+func (r *Rewrites) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		var rewrites []Rewrite
+		if err := json.Unmarshal(data, &rewrites); err != nil {
+			return err
+		}
+		*r = rewrites
+		return nil
+	}
+
+	// We decode the object a token at a time, because decoding it into a map
+	// would lose the order the rewrites were written in.
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	var rewrites []Rewrite
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		var to string
+		if err := decoder.Decode(&to); err != nil {
+			return fmt.Errorf("rewrite for %q: %w", token, err)
+		}
+		rewrites = append(rewrites, Rewrite{From: token.(string), To: to})
+	}
+	*r = rewrites
+	return nil
+}
+
+// Validate returns an error if any of the From expressions or paths are
+// invalid.
+//
+// An empty From is rejected, as it matches between every character and would
+// insert the To text throughout the file.
+func (r Rewrites) Validate() error {
+	for ix, rewrite := range r {
+		if len(rewrite.From) == 0 {
+			return fmt.Errorf("rewrite %d: from must not be empty", ix+1)
+		}
+		if _, err := regexp.Compile(rewrite.From); err != nil {
+			return fmt.Errorf("invalid rewrite %s: %w", rewrite, err)
+		}
+		if len(rewrite.Path) > 0 {
+			if err := strip.Validate([]string{rewrite.Path}); err != nil {
+				return fmt.Errorf("invalid rewrite %s: %w", rewrite, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply returns data with every rewrite that doesn't target a JSON path
+// applied in order.
+func (r Rewrites) Apply(data []byte) ([]byte, error) {
+	return r.apply(nil, data)
+}
+
+// apply is the same as Apply, but calls hits with the index and number of
+// matches for each rewrite if it isn't nil.
+func (r Rewrites) apply(hits func(ix, matches int), data []byte) ([]byte, error) {
+	for ix, rewrite := range r {
+		if len(rewrite.Path) > 0 {
+			continue
+		}
+
+		re, err := regexp.Compile(rewrite.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite %s: %w", rewrite, err)
+		}
+		if hits != nil {
+			hits(ix, len(re.FindAllIndex(data, -1)))
+		}
+		data = re.ReplaceAll(data, []byte(rewrite.To))
+	}
+	return data, nil
+}
+
+// ApplyJson returns data with every rewrite that targets a JSON path applied
+// in order. The rewrites are only applied to string values, any other values
+// are left alone.
+func (r Rewrites) ApplyJson(data interface{}) (interface{}, error) {
+	return r.applyJson(new(strip.Report), nil, data)
+}
+
+// applyJson is the same as ApplyJson, but records any warnings about the
+// paths in the report, and calls hits with the index and number of matches for
+// each rewrite if it isn't nil.
+func (r Rewrites) applyJson(report *strip.Report, hits func(ix, matches int), data interface{}) (interface{}, error) {
+	for ix, rewrite := range r {
+		if len(rewrite.Path) == 0 {
+			continue
+		}
+
+		re, err := regexp.Compile(rewrite.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite %s: %w", rewrite, err)
+		}
+
+		if data, err = report.Transform([]string{rewrite.Path}, data, func(value interface{}) interface{} {
+			return rewriteStrings(re, rewrite.To, value, func(matches int) {
+				if hits != nil {
+					hits(ix, matches)
+				}
+			})
+		}); err != nil {
+			return nil, fmt.Errorf("rewrite %s: %w", rewrite, err)
+		}
+	}
+	return data, nil
+}
+
+func rewriteStrings(re *regexp.Regexp, replacement string, value interface{}, matched func(matches int)) interface{} {
+	switch value := value.(type) {
+	case string:
+		matched(len(re.FindAllStringIndex(value, -1)))
+		return re.ReplaceAllString(value, replacement)
+	case []interface{}:
+		for ix, item := range value {
+			value[ix] = rewriteStrings(re, replacement, item, matched)
+		}
+		return value
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = rewriteStrings(re, replacement, item, matched)
+		}
+		return value
+	default:
+		return value
+	}
+}
+
+// mergeRewrites returns the parent rewrites followed by the child rewrites,
+// where a child rewrite with the same From and Path as a parent rewrite
+// replaces it in place.
+func mergeRewrites(parent, child Rewrites) Rewrites {
+	merged := append(Rewrites{}, parent...)
+	for _, rewrite := range child {
+		replaced := false
+		for ix := range merged {
+			if merged[ix].sameAs(rewrite) {
+				merged[ix] = rewrite
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, rewrite)
+		}
+	}
+	return merged
+}
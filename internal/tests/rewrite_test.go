@@ -0,0 +1,236 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/opentofu/equivalence-testing/internal/files"
+)
+
+func TestRewritesUnmarshal(t *testing.T) {
+	tcs := map[string]struct {
+		input    string
+		expected Rewrites
+	}{
+		"map keeps the written order": {
+			input: `{"terraform": "opentf", "Terraform": "OpenTF", "OpenTF": "OpenTofu"}`,
+			expected: Rewrites{
+				{From: "terraform", To: "opentf"},
+				{From: "Terraform", To: "OpenTF"},
+				{From: "OpenTF", To: "OpenTofu"},
+			},
+		},
+		"list": {
+			input: `[{"from": "Terraform", "to": "OpenTF", "description": "product name"}, {"from": "OpenTF", "to": "OpenTofu"}]`,
+			expected: Rewrites{
+				{From: "Terraform", To: "OpenTF", Description: "product name"},
+				{From: "OpenTF", To: "OpenTofu"},
+			},
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			var actual Rewrites
+			if err := json.Unmarshal([]byte(tc.input), &actual); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expected, actual); len(diff) > 0 {
+				t.Errorf("unexpected rewrites:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRewritesApplyInOrder(t *testing.T) {
+	rewrites := Rewrites{
+		{From: "Terraform", To: "OpenTF"},
+		{From: "OpenTF", To: "OpenTofu"},
+	}
+
+	// Run it several times, so any dependence on map ordering would show up.
+	for ix := 0; ix < 10; ix++ {
+		actual, err := rewrites.Apply([]byte("Terraform and OpenTF"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(actual) != "OpenTofu and OpenTofu" {
+			t.Fatalf("unexpected output: %s", actual)
+		}
+	}
+}
+
+func TestAddRewrites(t *testing.T) {
+	specification := TestSpecification{
+		Rewrites: map[string]Rewrites{
+			"plan": {{From: "terraform", To: "tofu"}},
+		},
+	}
+	specification.AddRewrites(map[string]Rewrites{
+		"plan":  {{From: "Terraform", To: "OpenTF"}, {From: "terraform", To: "opentf"}},
+		"state": {{From: "Terraform", To: "OpenTF"}},
+	})
+
+	output := TestOutput{Test: Test{Specification: specification}}
+
+	// The global rewrite for terraform in plan is overridden by the
+	// specification.
+	expected := map[string]string{
+		"plan":  "tofu OpenTF",
+		"state": "OpenTF terraform",
+	}
+	for name, input := range map[string]string{
+		"plan":  "terraform Terraform",
+		"state": "Terraform terraform",
+	} {
+		actual, err := output.render(name, files.NewRawFile(input), nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(actual) != expected[name] {
+			t.Errorf("%s: expected %q, got %q", name, expected[name], actual)
+		}
+	}
+}
+
+func TestAddRewritesAcrossPatterns(t *testing.T) {
+	specification := TestSpecification{
+		Rewrites: map[string]Rewrites{
+			"*.json":    {{From: "OpenTF", To: "OpenTofu"}, {From: "id", To: "identifier"}},
+			"plan.json": {{From: "x", To: "y"}},
+		},
+	}
+	specification.AddRewrites(map[string]Rewrites{
+		"plan.json": {{From: "Terraform", To: "OpenTF"}},
+		"*":         {{From: "id", To: "ID"}, {From: "c", To: "d"}},
+	})
+
+	output := TestOutput{Test: Test{Specification: specification}}
+
+	// The global rewrites come after every rewrite from the specification,
+	// even though their keys sort first, so Terraform isn't rewritten all the
+	// way to OpenTofu. The global rewrite for id is overridden by the
+	// specification, so identifier isn't rewritten again.
+	actual, err := output.render("plan.json", files.NewRawFile("Terraform id c x"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "OpenTF identifier d y"; string(actual) != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestValidateRewritesEmptyFrom(t *testing.T) {
+	tcs := map[string]struct {
+		specification TestSpecification
+		expected      string
+	}{
+		"specification": {
+			specification: TestSpecification{
+				Rewrites: map[string]Rewrites{
+					"plan": {{From: "Terraform", To: "OpenTofu"}, {To: "Changes"}},
+				},
+			},
+			expected: "rewrites for plan: rewrite 2: from must not be empty",
+		},
+		"path": {
+			specification: TestSpecification{
+				Rewrites: map[string]Rewrites{
+					"plan.json": {{To: "x", Path: "resource_changes.*.name"}},
+				},
+			},
+			expected: "rewrites for plan.json: rewrite 1: from must not be empty",
+		},
+		"global": {
+			specification: TestSpecification{
+				GlobalRewrites: map[string]Rewrites{
+					"*": {{To: "x"}},
+				},
+			},
+			expected: "global rewrites for *: rewrite 1: from must not be empty",
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			err := tc.specification.ValidateRewrites()
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if err.Error() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestScopedRewrites(t *testing.T) {
+	output := TestOutput{
+		Test: Test{
+			Specification: TestSpecification{
+				Rewrites: map[string]Rewrites{
+					"*.json": {
+						{From: "Terraform", To: "OpenTofu", Path: "values.*.description"},
+					},
+					"step_*/plan": {
+						{From: "terraform", To: "tofu"},
+					},
+				},
+			},
+		},
+		files: map[string]*files.File{
+			"step_1/state.json": jsonFile(t, `{"values": {"a": {"description": "Terraform", "name": "Terraform"}}, "version": "Terraform"}`),
+			"step_1/plan":       files.NewRawFile("terraform plan"),
+			"plan":              files.NewRawFile("terraform plan"),
+		},
+	}
+
+	outputs, err := output.Files()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"step_1/state.json": `{"values":{"a":{"description":"OpenTofu","name":"Terraform"}},"version":"Terraform"}`,
+		"step_1/plan":       "tofu plan",
+		"plan":              "terraform plan",
+	}
+	for name, file := range outputs {
+		data, err := output.render(name, file, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if file.Ext() == files.Json {
+			var buffer bytes.Buffer
+			if err := json.Compact(&buffer, data); err != nil {
+				t.Fatal(err)
+			}
+			data = buffer.Bytes()
+		}
+
+		if string(data) != expected[name] {
+			t.Errorf("%s: expected %s, got %s", name, expected[name], data)
+		}
+	}
+}
+
+func TestRewritesInvalidJson(t *testing.T) {
+	output := TestOutput{
+		Test: Test{
+			Specification: TestSpecification{
+				Rewrites: map[string]Rewrites{
+					"state.json": {{From: `"name"`, To: `name`}},
+				},
+			},
+		},
+	}
+
+	if _, err := output.render("state.json", jsonFile(t, `{"name": "value"}`), nil); err == nil {
+		t.Errorf("expected an error for a rewrite that produces invalid JSON")
+	}
+}
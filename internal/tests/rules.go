@@ -0,0 +1,167 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ruleHits counts how many times each of the ignore_fields and rewrites of a
+// test specification matched the output files of the test.
+type ruleHits struct {
+	// fields maps the file name or pattern that the ignore_fields are listed
+	// under to the hits for each field.
+	fields map[string]map[string]int
+
+	rewrites map[rewriteID]int
+}
+
+// rewriteID identifies a single rewrite by the file name or pattern it is
+// listed under and its position in that list, so identical rewrites listed
+// under different keys are counted separately.
+type rewriteID struct {
+	global bool
+	key    string
+	index  int
+}
+
+func newRuleHits() *ruleHits {
+	return &ruleHits{
+		fields:   map[string]map[string]int{},
+		rewrites: map[rewriteID]int{},
+	}
+}
+
+// addFields adds the hits for the fields listed under key. It does nothing if
+// the receiver is nil, so callers don't have to check whether hits are being
+// recorded.
+func (h *ruleHits) addFields(key string, hits map[string]int) {
+	if h == nil {
+		return
+	}
+
+	if h.fields[key] == nil {
+		h.fields[key] = map[string]int{}
+	}
+	for field, count := range hits {
+		h.fields[key][field] += count
+	}
+}
+
+// rewriteHits returns a function that adds the matches for the rewrite at
+// each index of a list of rewrites to the rules identified by ids at the same
+// index, or nil if the receiver is nil.
+func (h *ruleHits) rewriteHits(ids [][]rewriteID) func(ix, matches int) {
+	if h == nil {
+		return nil
+	}
+	return func(ix, matches int) {
+		for _, id := range ids[ix] {
+			h.rewrites[id] += matches
+		}
+	}
+}
+
+// GlobalRewriteHits counts how many times each global rewrite matched the
+// output files of one or more tests. The counts are keyed by the file name or
+// pattern the rewrites are listed under, and then by their position in that
+// list.
+type GlobalRewriteHits map[string]map[int]int
+
+// Add adds the counts from other into h.
+func (h GlobalRewriteHits) Add(other GlobalRewriteHits) {
+	for key, counts := range other {
+		if h[key] == nil {
+			h[key] = map[int]int{}
+		}
+		for ix, count := range counts {
+			h[key][ix] += count
+		}
+	}
+}
+
+// Unused returns a description of each of the global rewrites that didn't
+// match anything according to h.
+func (h GlobalRewriteHits) Unused(rewrites map[string]Rewrites) []string {
+	var keys []string
+	for key := range rewrites {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var unused []string
+	for _, key := range keys {
+		for ix, rewrite := range rewrites[key] {
+			if h[key][ix] == 0 {
+				unused = append(unused, fmt.Sprintf("global rewrites for %s: %s matched nothing", key, rewrite))
+			}
+		}
+	}
+	return unused
+}
+
+// UnusedRules returns a description of each of the ignore_fields and rewrites
+// in the test specification that didn't match anything in any of the output
+// files of this test.
+//
+// Rules that match nothing hide nothing today, but could hide a real change in
+// the output later. This includes rules inherited from defaults. Global
+// rewrites usually only apply to some of the tests, so they aren't reported
+// here. Instead, the matches for each global rewrite are returned so they can
+// be checked across every test with GlobalRewriteHits.Unused.
+func (output TestOutput) UnusedRules() ([]string, GlobalRewriteHits, error) {
+	processed := output.results()
+	if processed.err != nil {
+		return nil, nil, processed.err
+	}
+	if processed.renderErr != nil {
+		return nil, nil, processed.renderErr
+	}
+	hits := processed.hits
+
+	var unused []string
+
+	specification := output.Test.Specification
+
+	var keys []string
+	for key := range specification.IgnoreFields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, field := range specification.IgnoreFields[key] {
+			if hits.fields[key][field] == 0 {
+				unused = append(unused, fmt.Sprintf("ignore_fields for %s: %q matched nothing", key, field))
+			}
+		}
+	}
+
+	keys = nil
+	for key := range specification.Rewrites {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for ix, rewrite := range specification.Rewrites[key] {
+			if hits.rewrites[rewriteID{key: key, index: ix}] == 0 {
+				unused = append(unused, fmt.Sprintf("rewrites for %s: %s matched nothing", key, rewrite))
+			}
+		}
+	}
+
+	global := GlobalRewriteHits{}
+	for id, count := range hits.rewrites {
+		if !id.global {
+			continue
+		}
+		if global[id.key] == nil {
+			global[id.key] = map[int]int{}
+		}
+		global[id.key][id.index] += count
+	}
+	return unused, global, nil
+}
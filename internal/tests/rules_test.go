@@ -0,0 +1,107 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/opentofu/equivalence-testing/internal/files"
+)
+
+func TestUnusedRules(t *testing.T) {
+	output := TestOutput{
+		Test: Test{
+			Specification: TestSpecification{
+				IgnoreFields: map[string][]string{
+					"plan.json":        {"format_version", "resource_changes[address=null_resource.gone]"},
+					"state.json":       {"values"},
+					"step_2/plan.json": {"planned_values"},
+				},
+				Rewrites: map[string]Rewrites{
+					"*.json": {
+						{From: "null_resource", To: "resource"},
+						{From: "aws_instance", To: "instance"},
+					},
+					"plan": {
+						{From: "missing", To: "value"},
+					},
+					"step_1/plan.json": {
+						{From: "x", To: "y", Path: "resource_changes.*.name"},
+					},
+					"state.json": {
+						{From: "null_resource", To: "resource"},
+					},
+				},
+				GlobalRewrites: map[string]Rewrites{
+					"*.json": {
+						{From: "null_resource", To: "resource"},
+					},
+					"plan": {
+						{From: "Plan", To: "Changes"},
+						{From: "nothing", To: "value"},
+					},
+				},
+			},
+		},
+		files: map[string]*files.File{
+			"step_1/plan.json": jsonFile(t, `{"format_version": "1.0", "resource_changes": [{"address": "null_resource.a", "name": "x"}]}`),
+			"step_2/plan.json": jsonFile(t, `{"resource_changes": []}`),
+			"step_1/plan":      files.NewRawFile("Plan: 1 to add"),
+		},
+	}
+
+	unused, global, err := output.UnusedRules()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		`ignore_fields for plan.json: "resource_changes[address=null_resource.gone]" matched nothing`,
+		`ignore_fields for state.json: "values" matched nothing`,
+		`ignore_fields for step_2/plan.json: "planned_values" matched nothing`,
+		`rewrites for *.json: "aws_instance" matched nothing`,
+		`rewrites for plan: "missing" matched nothing`,
+		`rewrites for state.json: "null_resource" matched nothing`,
+	}
+	if diff := cmp.Diff(expected, unused); len(diff) > 0 {
+		t.Errorf("unexpected unused rules:\n%s", diff)
+	}
+
+	// The global rewrite for *.json is overridden by the same rewrite from
+	// the specification, so it is credited with the matches of that rewrite
+	// instead of being reported as unused.
+	expectedGlobal := GlobalRewriteHits{
+		"*.json": {0: 1},
+		"plan":   {0: 1, 1: 0},
+	}
+	if diff := cmp.Diff(expectedGlobal, global); len(diff) > 0 {
+		t.Errorf("unexpected global rewrite hits:\n%s", diff)
+	}
+}
+
+func TestGlobalRewriteHitsUnused(t *testing.T) {
+	rewrites := map[string]Rewrites{
+		"plan": {
+			{From: "Plan", To: "Changes"},
+			{From: "nothing", To: "value"},
+		},
+		"*.json": {
+			{From: "null_resource", To: "resource"},
+		},
+	}
+
+	hits := GlobalRewriteHits{}
+	hits.Add(GlobalRewriteHits{"plan": {0: 1, 1: 0}})
+	hits.Add(GlobalRewriteHits{"*.json": {0: 2}, "plan": {0: 1}})
+	hits.Add(GlobalRewriteHits{"plan": {1: 0}})
+
+	expected := []string{
+		`global rewrites for plan: "nothing" matched nothing`,
+	}
+	if diff := cmp.Diff(expected, hits.Unused(rewrites)); len(diff) > 0 {
+		t.Errorf("unexpected unused rules:\n%s", diff)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+//go:generate go run gen_schema.go ../../schema/spec.schema.json
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/opentofu/equivalence-testing/internal/binary"
+)
+
+const (
+	// SchemaKey is the key a spec.json or defaults.json file can use to
+	// reference the JSON schema, so editors can provide autocompletion. It is
+	// otherwise ignored.
+	SchemaKey = "$schema"
+
+	schemaVersion = "http://json-schema.org/draft-07/schema#"
+)
+
+// Schema is the subset of JSON Schema needed to describe a test
+// specification.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+}
+
+// SpecificationSchema returns the JSON schema for the spec.json and
+// defaults.json files, generated from the TestSpecification type.
+func SpecificationSchema() *Schema {
+	schema := schemaFor(reflect.TypeOf(TestSpecification{}))
+	schema.Schema = schemaVersion
+	schema.Title = "equivalence-testing test specification"
+	schema.Properties[SchemaKey] = &Schema{Type: "string"}
+	return schema
+}
+
+// WriteSpecificationSchema returns the JSON schema from SpecificationSchema,
+// formatted as it is stored in the repository.
+func WriteSpecificationSchema() ([]byte, error) {
+	data, err := json.MarshalIndent(SpecificationSchema(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+var (
+	durationType = reflect.TypeOf(binary.Duration(0))
+	rewritesType = reflect.TypeOf(Rewrites{})
+)
+
+func schemaFor(t reflect.Type) *Schema {
+	switch t {
+	case durationType:
+		return &Schema{Type: "string"}
+	case rewritesType:
+		// Rewrites can be written as a list, or as a map from each From to its
+		// To.
+		return &Schema{
+			AnyOf: []*Schema{
+				{Type: "array", Items: schemaFor(t.Elem())},
+				{Type: "object", AdditionalProperties: &Schema{Type: "string"}},
+			},
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice:
+		return &Schema{Type: "array", Items: schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaFor(t.Elem())}
+	case reflect.Struct:
+		schema := &Schema{
+			Type:                 "object",
+			Properties:           map[string]*Schema{},
+			AdditionalProperties: false,
+		}
+		for ix := 0; ix < t.NumField(); ix++ {
+			name := jsonName(t.Field(ix))
+			if len(name) == 0 || name == "-" {
+				continue
+			}
+			schema.Properties[name] = schemaFor(t.Field(ix).Type)
+		}
+		return schema
+	default:
+		// Anything else, eg. interface{}, accepts any value.
+		return &Schema{}
+	}
+}
+
+// Validate checks value, which must have been decoded from JSON into an
+// interface{}, against the schema and returns an error for every problem it
+// finds.
+func (s *Schema) Validate(value interface{}) []error {
+	return s.validate(value, "")
+}
+
+func (s *Schema) validate(value interface{}, path string) []error {
+	if len(s.AnyOf) > 0 {
+		var types []string
+		for _, alternative := range s.AnyOf {
+			if jsonType(value) == alternative.Type {
+				return alternative.validate(value, path)
+			}
+			types = append(types, alternative.Type)
+		}
+		return []error{schemaError(path, "expected %s, found %s", strings.Join(types, " or "), jsonType(value))}
+	}
+
+	if len(s.Type) == 0 {
+		return nil
+	}
+
+	if actual := jsonType(value); actual != s.Type && !(s.Type == "number" && actual == "integer") {
+		return []error{schemaError(path, "expected %s, found %s", s.Type, actual)}
+	}
+
+	var errs []error
+	switch value := value.(type) {
+	case []interface{}:
+		for ix, item := range value {
+			errs = append(errs, s.Items.validate(item, fmt.Sprintf("%s[%d]", path, ix))...)
+		}
+	case map[string]interface{}:
+		var keys []string
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			child := key
+			if len(path) > 0 {
+				child = path + "." + key
+			}
+
+			if property, ok := s.Properties[key]; ok {
+				errs = append(errs, property.validate(value[key], child)...)
+				continue
+			}
+
+			switch additional := s.AdditionalProperties.(type) {
+			case *Schema:
+				errs = append(errs, additional.validate(value[key], child)...)
+			default:
+				errs = append(errs, schemaError(path, "unknown field %q%s", key, suggest(key, s.Properties)))
+			}
+		}
+	}
+	return errs
+}
+
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func schemaError(path string, format string, args ...interface{}) error {
+	if len(path) == 0 {
+		return fmt.Errorf(format, args...)
+	}
+	return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+}
+
+// suggest returns a hint naming the known property that key was most likely
+// meant to be, or an empty string if there isn't an obvious candidate.
+func suggest(key string, properties map[string]*Schema) string {
+	normalized := strings.ToLower(strings.ReplaceAll(key, "-", "_"))
+	for name := range properties {
+		if strings.ReplaceAll(name, "_", "") == strings.ReplaceAll(normalized, "_", "") {
+			return fmt.Sprintf(", did you mean %q?", name)
+		}
+	}
+	return ""
+}
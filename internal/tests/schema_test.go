@@ -0,0 +1,87 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSpecificationSchemaUpToDate(t *testing.T) {
+	expected, err := WriteSpecificationSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := os.ReadFile("../../schema/spec.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(string(expected), string(actual)); len(diff) > 0 {
+		t.Errorf("schema/spec.schema.json is out of date, run `go generate ./...` to update it:\n%s", diff)
+	}
+}
+
+func TestSpecificationSchemaValidate(t *testing.T) {
+	tcs := map[string]struct {
+		spec     string
+		expected []string
+	}{
+		"valid": {
+			spec: `{
+  "$schema": "spec.schema.json",
+  "include_files": ["plan.json"],
+  "variables": {"list": [1, "a"], "object": {"a": null}},
+  "timeout": "10m",
+  "commands": [{"name": "init", "arguments": ["init"], "retries": 2}],
+  "steps": [{"directory": "step_1"}]
+}`,
+		},
+		"unknown fields": {
+			spec: `{
+  "IncludeFiles": ["plan.json"],
+  "commands": [{"name": "init", "argument": ["init"]}]
+}`,
+			expected: []string{
+				`unknown field "IncludeFiles", did you mean "include_files"?`,
+				`commands[0]: unknown field "argument"`,
+			},
+		},
+		"wrong types": {
+			spec: `{
+  "include_files": "plan.json",
+  "env": {"A": 1},
+  "timeout": 10,
+  "commands": [{"name": "init", "retries": 1.5}]
+}`,
+			expected: []string{
+				"commands[0].retries: expected integer, found number",
+				"env.A: expected string, found integer",
+				"include_files: expected array, found string",
+				"timeout: expected string, found integer",
+			},
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tc.spec), &value); err != nil {
+				t.Fatal(err)
+			}
+
+			var actual []string
+			for _, err := range SpecificationSchema().Validate(value) {
+				actual = append(actual, err.Error())
+			}
+
+			if diff := cmp.Diff(tc.expected, actual); len(diff) > 0 {
+				t.Errorf("expected:\n%v\nactual:\n%v\ndiff:\n%s", tc.expected, actual, diff)
+			}
+		})
+	}
+}
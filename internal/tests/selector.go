@@ -0,0 +1,112 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Selector decides which of the test cases within a directory should be
+// executed.
+//
+// A test is selected if it passes every one of the non-empty include rules
+// (Names, Tags, and Match), and doesn't match any of the exclude rules
+// (ExcludeTags and Exclude).
+type Selector struct {
+	// Names selects tests whose name exactly matches one of these.
+	Names []string
+
+	// Tags selects tests that have at least one of these tags.
+	Tags []string
+
+	// ExcludeTags excludes tests that have at least one of these tags.
+	ExcludeTags []string
+
+	// Match selects tests whose name matches at least one of these patterns.
+	//
+	// Patterns are globs, as accepted by path.Match, unless they are wrapped
+	// in slashes (eg. /^provider_.*$/) in which case they are regular
+	// expressions.
+	Match []string
+
+	// Exclude excludes tests whose name matches at least one of these
+	// patterns, using the same format as Match.
+	Exclude []string
+}
+
+// Validate returns an error if any of the patterns in the selector are
+// invalid.
+func (s Selector) Validate() error {
+	for _, pattern := range append(append([]string{}, s.Match...), s.Exclude...) {
+		if _, err := matchPattern(pattern, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SelectsName returns true if the named test might be selected, ignoring any
+// rules that need the test specification.
+func (s Selector) SelectsName(name string) bool {
+	if len(s.Names) > 0 && !contains(name, s.Names) {
+		return false
+	}
+
+	if len(s.Match) > 0 && !matchesAny(s.Match, name) {
+		return false
+	}
+
+	return !matchesAny(s.Exclude, name)
+}
+
+// Selects returns true if the test should be executed.
+func (s Selector) Selects(test Test) bool {
+	if !s.SelectsName(test.Name) {
+		return false
+	}
+
+	if len(s.Tags) > 0 && !containsAny(test.Specification.Tags, s.Tags) {
+		return false
+	}
+
+	return !containsAny(test.Specification.Tags, s.ExcludeTags)
+}
+
+func containsAny(values []string, targets []string) bool {
+	for _, value := range values {
+		if contains(value, targets) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		// We've already validated the patterns, so we can ignore the error.
+		if matched, _ := matchPattern(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPattern(pattern, name string) (bool, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return false, fmt.Errorf("invalid regular expression %q: %w", pattern, err)
+		}
+		return re.MatchString(name), nil
+	}
+
+	matched, err := path.Match(pattern, name)
+	if err != nil {
+		return false, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+	}
+	return matched, nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"testing"
+)
+
+func TestSelector(t *testing.T) {
+	tests := []Test{
+		{Name: "simple_resource", Specification: TestSpecification{Tags: []string{"smoke"}}},
+		{Name: "complex_resource", Specification: TestSpecification{Tags: []string{"smoke", "slow"}}},
+		{Name: "providers/aws_instance", Specification: TestSpecification{Tags: []string{"slow"}}},
+		{Name: "providers/local_file"},
+	}
+
+	tcs := map[string]struct {
+		selector Selector
+		expected []string
+	}{
+		"empty": {
+			selector: Selector{},
+			expected: []string{"simple_resource", "complex_resource", "providers/aws_instance", "providers/local_file"},
+		},
+		"names": {
+			selector: Selector{Names: []string{"simple_resource", "providers/local_file"}},
+			expected: []string{"simple_resource", "providers/local_file"},
+		},
+		"tags": {
+			selector: Selector{Tags: []string{"smoke"}},
+			expected: []string{"simple_resource", "complex_resource"},
+		},
+		"exclude_tags": {
+			selector: Selector{ExcludeTags: []string{"slow"}},
+			expected: []string{"simple_resource", "providers/local_file"},
+		},
+		"tags_and_exclude_tags": {
+			selector: Selector{Tags: []string{"smoke"}, ExcludeTags: []string{"slow"}},
+			expected: []string{"simple_resource"},
+		},
+		"glob": {
+			selector: Selector{Match: []string{"providers/*"}},
+			expected: []string{"providers/aws_instance", "providers/local_file"},
+		},
+		"regex": {
+			selector: Selector{Match: []string{"/_resource$/"}},
+			expected: []string{"simple_resource", "complex_resource"},
+		},
+		"exclude": {
+			selector: Selector{Match: []string{"providers/*"}, Exclude: []string{"/aws/"}},
+			expected: []string{"providers/local_file"},
+		},
+		"everything": {
+			selector: Selector{Tags: []string{"slow"}, Match: []string{"*_resource"}},
+			expected: []string{"complex_resource"},
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			if err := tc.selector.Validate(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var selected []string
+			for _, test := range tests {
+				if tc.selector.Selects(test) {
+					selected = append(selected, test.Name)
+				}
+			}
+
+			if len(selected) != len(tc.expected) {
+				t.Fatalf("expected %v but found %v", tc.expected, selected)
+			}
+			for ix := range selected {
+				if selected[ix] != tc.expected[ix] {
+					t.Fatalf("expected %v but found %v", tc.expected, selected)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectorInvalidPattern(t *testing.T) {
+	if err := (Selector{Match: []string{"/[/"}}).Validate(); err == nil {
+		t.Errorf("expected an error for an invalid regular expression")
+	}
+	if err := (Selector{Exclude: []string{"["}}).Validate(); err == nil {
+		t.Errorf("expected an error for an invalid glob")
+	}
+}
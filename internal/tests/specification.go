@@ -3,45 +3,544 @@
 
 package tests
 
-import "github.com/opentofu/equivalence-testing/internal/binary"
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+
+	"github.com/opentofu/equivalence-testing/internal/binary"
+	"github.com/opentofu/equivalence-testing/internal/files"
+	strip "github.com/opentofu/equivalence-testing/internal/json"
+)
 
 // TestSpecification is a struct that provides the specification for a given
 // test case.
 //
 // Each test has a set of additional files that should be included in the
-// golden file update and diff functions, these are specified in the
-// IncludeFiles field.
+// golden file update and diff functions, these are specified by the glob
+// patterns in the IncludeFiles field, minus any matching the ExcludeFiles
+// field.
 //
 // Each test also has a set of JSON fields for each file that should be ignored
 // when updating or diffing, these are specified in the IgnoreFields field.
+// Fields that should be kept, but whose values should be ignored, are
+// specified in the MaskFields field.
+//
+// Each test can also provide input variables, either directly in the
+// Variables field or through the files listed in the VarFiles field.
 type TestSpecification struct {
-	IncludeFiles []string                     `json:"include_files"`
-	IgnoreFields map[string][]string          `json:"ignore_fields"`
-	Rewrites     map[string]map[string]string `json:"rewrites"`
+	IncludeFiles []string            `json:"include_files,omitempty"`
+	ExcludeFiles []string            `json:"exclude_files,omitempty"`
+	IgnoreFields map[string][]string `json:"ignore_fields,omitempty"`
+	MaskFields   map[string][]string `json:"mask_fields,omitempty"`
+
+	// Codecs maps the names of additional files, or glob patterns that match
+	// them, to the codec that should read them instead of the codec chosen by
+	// their extension, eg. "yaml" or "raw".
+	Codecs map[string]string `json:"codecs,omitempty"`
+
+	// IgnoreLines maps the names of raw (non-JSON) output files to filters
+	// that remove lines from them.
+	IgnoreLines map[string][]LineFilter `json:"ignore_lines,omitempty"`
+
+	// Rewrites maps file names, or glob patterns that match file names, to the
+	// rewrites that are applied to them, in order, before they are compared
+	// with or written into the golden files.
+	Rewrites map[string]Rewrites `json:"rewrites,omitempty"`
+
+	// GlobalRewrites are the rewrites from the --rewrites flag, see
+	// AddRewrites. They can't be set by the specification itself.
+	GlobalRewrites map[string]Rewrites `json:"-"`
+
+	// Variables are passed into every command as TF_VAR_ environment
+	// variables.
+	Variables map[string]interface{} `json:"variables,omitempty"`
+
+	// VarFiles are paths, relative to the test directory, that are passed
+	// into the default plan command with the -var-file argument. Custom
+	// commands never receive them, see ValidateVarFiles.
+	VarFiles []string `json:"var_files,omitempty"`
+
+	// Env contains additional environment variables that are passed into
+	// every command. Individual commands can add to or override these with
+	// their own Env field.
+	Env map[string]string `json:"env,omitempty"`
+
+	// IsolateEnv tells the framework to only pass an allowlist of host
+	// environment variables to the binary, and to point HOME, TMPDIR and
+	// TF_DATA_DIR at directories that are unique to this test.
+	IsolateEnv bool `json:"isolate_env,omitempty"`
+
+	// AllowEnv contains the names of additional host environment variables
+	// that should be passed to the binary when IsolateEnv is true.
+	AllowEnv []string `json:"allow_env,omitempty"`
 
 	// If Commands is empty, then we will execute a default set of commands:
 	// [init, plan, apply, show, show plan]. Otherwise, these are the set of
 	// commands that should be executed by the equivalence test framework for
 	// this test case.
-	Commands []binary.Command `json:"commands"`
+	Commands []binary.Command `json:"commands,omitempty"`
+
+	// If Steps is not empty, then the test is executed as a series of steps
+	// that all share the same working directory and state. The outputs of each
+	// step are written into a step_N subdirectory of the golden files, where N
+	// starts at 1.
+	Steps []TestStep `json:"steps,omitempty"`
+
+	// RequiresVersion is a version constraint, eg. ">= 1.6.0", that the binary
+	// must satisfy for this test to be executed. Tests that don't support the
+	// binary are skipped, and their golden files are left alone.
+	RequiresVersion string `json:"requires_version,omitempty"`
+
+	// Tags are used to select groups of tests to execute, eg. "smoke" or
+	// "slow".
+	Tags []string `json:"tags,omitempty"`
+
+	// Timeout is the maximum time the whole test can take, eg. "10m". Any
+	// command still running when the test runs out of time is killed. If this
+	// is zero, the test can run forever.
+	Timeout binary.Duration `json:"timeout,omitempty"`
+
+	// Normalize lists the normalizers that replace volatile values, such as
+	// UUIDs or timestamps, with tokens that are stable across every output
+	// file of the test.
+	Normalize []Normalizer `json:"normalize,omitempty"`
+
+	// Assertions are conditions that must hold for the outputs of the test,
+	// and are checked separately from the golden files.
+	Assertions []Assertion `json:"assertions,omitempty"`
+
+	// NoInherit lists the fields, by their JSON names, that should not be
+	// inherited from any defaults.json files. See Inherit for details.
+	NoInherit []string `json:"no_inherit,omitempty"`
+}
+
+// TestStep is a single step within a multi-step test case.
+//
+// Before the commands for a step are executed, the files in Directory are
+// copied over the top of the working directory and the files in RemoveFiles
+// are deleted from it. This lets each step evolve the configuration from the
+// previous step.
+type TestStep struct {
+	// Directory is the path, relative to the test directory, of the overlay
+	// for this step. This can be empty, in which case the configuration isn't
+	// changed.
+	Directory string `json:"directory,omitempty"`
+
+	// RemoveFiles are paths, relative to the working directory, that should
+	// be deleted before the commands for this step are executed.
+	RemoveFiles []string `json:"remove_files,omitempty"`
+
+	// Commands are the commands to execute for this step. If this is empty,
+	// the Commands from the test specification are used instead, which in turn
+	// fall back to the default set of commands.
+	Commands []binary.Command `json:"commands,omitempty"`
+}
+
+// Options returns the binary.Options that should be used when executing the
+// test described by this specification.
+func (s TestSpecification) Options() binary.Options {
+	return binary.Options{
+		Variables:  s.Variables,
+		VarFiles:   s.VarFiles,
+		Env:        s.Env,
+		IsolateEnv: s.IsolateEnv,
+		AllowedEnv: s.AllowEnv,
+		Codecs:     s.Codecs,
+	}
+}
+
+// IncludePatterns returns the patterns that choose the additional files to
+// include as golden files.
+func (s TestSpecification) IncludePatterns() files.Patterns {
+	return files.Patterns{
+		Include: s.IncludeFiles,
+		Exclude: s.ExcludeFiles,
+	}
+}
+
+// ValidateCodecs returns an error if any of the codec overrides within the
+// specification use an invalid pattern or an unrecognized codec.
+func (s TestSpecification) ValidateCodecs() error {
+	return files.CodecOverrides(s.Codecs).Validate()
+}
+
+// ValidateVarFiles returns an error if the specification lists var_files that
+// would never be used.
+//
+// The var_files are only passed into the default plan command, so they are
+// ignored by tests where every step executes custom commands.
+func (s TestSpecification) ValidateVarFiles() error {
+	if len(s.VarFiles) == 0 {
+		return nil
+	}
+
+	usesDefaults := len(s.Commands) == 0 && len(s.Steps) == 0
+	if len(s.Commands) == 0 {
+		for _, step := range s.Steps {
+			if len(step.Commands) == 0 {
+				usesDefaults = true
+			}
+		}
+	}
+	if !usesDefaults {
+		return errors.New("var_files are only passed into the default commands, so they can't be used with custom commands; pass the files in the arguments of the commands instead")
+	}
+	return nil
+}
+
+// AddRewrites adds the global rewrites into this specification.
+//
+// The global rewrites are kept apart from the rewrites of the specification.
+// For each output file, every global rewrite that applies to the file is
+// applied after every rewrite from the specification that applies to the
+// file, whichever file names or patterns they are listed under. Global
+// rewrites with the same From and Path as a rewrite from the specification
+// for the same file are ignored, so the specification always takes
+// precedence.
+func (s *TestSpecification) AddRewrites(rewrites map[string]Rewrites) {
+	if s.GlobalRewrites == nil {
+		s.GlobalRewrites = make(map[string]Rewrites)
+	}
+
+	for file, fileRewrites := range rewrites {
+		s.GlobalRewrites[file] = append(s.GlobalRewrites[file], fileRewrites...)
+	}
 }
 
-func (s *TestSpecification) AddRewrites(rewrites map[string]map[string]string) {
-	if s.Rewrites == nil {
-		s.Rewrites = make(map[string]map[string]string)
+// ValidateFields returns an error if any of the ignore_fields or mask_fields
+// within the specification don't use the accepted path syntax.
+func (s TestSpecification) ValidateFields() error {
+	for _, fields := range []struct {
+		name   string
+		fields map[string][]string
+	}{
+		{"ignore_fields", s.IgnoreFields},
+		{"mask_fields", s.MaskFields},
+	} {
+		var files []string
+		for file := range fields.fields {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			if err := strip.Validate(fields.fields[file]); err != nil {
+				return fmt.Errorf("%s for %s: %w", fields.name, file, err)
+			}
+		}
 	}
+	return nil
+}
+
+// ValidateRewrites returns an error if any of the rewrites within the
+// specification, including the global rewrites, are invalid.
+func (s TestSpecification) ValidateRewrites() error {
+	for _, set := range []struct {
+		prefix   string
+		rewrites map[string]Rewrites
+	}{
+		{prefix: "rewrites", rewrites: s.Rewrites},
+		{prefix: "global rewrites", rewrites: s.GlobalRewrites},
+	} {
+		var files []string
+		for file := range set.rewrites {
+			files = append(files, file)
+		}
+		sort.Strings(files)
 
-	for path, pathRewrites := range rewrites {
-		current, exists := s.Rewrites[path]
-		if !exists {
-			s.Rewrites[path] = pathRewrites
-		} else {
-			for from, to := range pathRewrites {
-				// Only add the rewrite if it doesn't already exist.
-				if _, exists := s.Rewrites[path][from]; !exists {
-					current[from] = to
-				}
+		for _, file := range files {
+			if _, err := path.Match(file, ""); err != nil {
+				return fmt.Errorf("%s for %s: invalid file pattern: %w", set.prefix, file, err)
+			}
+			if err := set.rewrites[file].Validate(); err != nil {
+				return fmt.Errorf("%s for %s: %w", set.prefix, file, err)
 			}
 		}
 	}
+	return nil
+}
+
+var (
+	// inheritableFields are the JSON names of the fields that Inherit merges,
+	// and can therefore be listed in NoInherit.
+	inheritableFields = []string{
+		"include_files",
+		"exclude_files",
+		"ignore_fields",
+		"mask_fields",
+		"codecs",
+		"ignore_lines",
+		"rewrites",
+		"variables",
+		"var_files",
+		"env",
+		"isolate_env",
+		"allow_env",
+		"commands",
+		"steps",
+		"timeout",
+		"tags",
+		"requires_version",
+		"assertions",
+		"normalize",
+	}
+)
+
+// SupportsVersion returns true if the binary version satisfies the
+// RequiresVersion constraint of this specification. Prerelease versions are
+// checked as the release they precede, see coreVersion.
+func (s TestSpecification) SupportsVersion(binaryVersion string) (bool, error) {
+	if len(s.RequiresVersion) == 0 {
+		return true, nil
+	}
+
+	constraints, err := version.NewConstraint(s.RequiresVersion)
+	if err != nil {
+		return false, fmt.Errorf("invalid requires_version %q: %w", s.RequiresVersion, err)
+	}
+
+	v, err := coreVersion(binaryVersion)
+	if err != nil {
+		return false, err
+	}
+	return constraints.Check(v), nil
+}
+
+// coreVersion parses the version of the binary, and drops any prerelease or
+// metadata from it.
+//
+// Version constraints never match prerelease versions, so without this a
+// development build (eg. 1.7.0-dev or 1.7.0-alpha1) would never satisfy
+// ">= 1.6.0". Instead, prerelease builds are treated as the release they are
+// building towards.
+func coreVersion(binaryVersion string) (*version.Version, error) {
+	v, err := version.NewVersion(binaryVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid binary version %q: %w", binaryVersion, err)
+	}
+	return v.Core(), nil
+}
+
+// Inherit merges the parent specification, read from a defaults.json file,
+// into this specification. The rules for each type of field are:
+//
+//   - Lists of strings (include_files, exclude_files, var_files, allow_env,
+//     tags, and the lists within ignore_fields and mask_fields) are
+//     concatenated, with the parent entries first and duplicates removed. An
+//     entry prefixed with ! removes the matching entry inherited from the
+//     parent instead of being added.
+//   - Maps (variables, env, codecs) are merged, and where both specifications
+//     contain the same key the value from this specification is used.
+//   - Rewrites are concatenated for each file, with the parent rewrites first,
+//     except that a rewrite in this specification replaces any parent rewrite
+//     with the same From.
+//   - Lists of structs (commands, steps) are only inherited if this
+//     specification doesn't set any itself, they are never merged.
+//   - Assertions, and the line filters for each file within ignore_lines, are
+//     concatenated, with the parent entries first.
+//   - Normalizers are concatenated, with the parent normalizers first, except
+//     that a normalizer in this specification replaces any parent normalizer
+//     with the same name.
+//   - Booleans (isolate_env) are true if either specification sets them.
+//   - Other values (timeout, requires_version) are only inherited if this
+//     specification doesn't set them itself.
+//
+// Any fields listed in NoInherit are not inherited at all. NoInherit itself is
+// never inherited.
+func (s *TestSpecification) Inherit(parent TestSpecification) error {
+	skip := map[string]bool{}
+	for _, field := range s.NoInherit {
+		found := false
+		for _, inheritable := range inheritableFields {
+			if field == inheritable {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unrecognized field %q in no_inherit, expected one of %s", field, strings.Join(inheritableFields, ", "))
+		}
+		skip[field] = true
+	}
+
+	// We always merge, even if the field is skipped, so that any negated
+	// entries are removed from the final specification.
+	inherit := func(field string) bool {
+		return !skip[field]
+	}
+
+	s.IncludeFiles = mergeLists(parent.IncludeFiles, s.IncludeFiles, inherit("include_files"))
+	s.ExcludeFiles = mergeLists(parent.ExcludeFiles, s.ExcludeFiles, inherit("exclude_files"))
+	s.VarFiles = mergeLists(parent.VarFiles, s.VarFiles, inherit("var_files"))
+	s.AllowEnv = mergeLists(parent.AllowEnv, s.AllowEnv, inherit("allow_env"))
+	s.Tags = mergeLists(parent.Tags, s.Tags, inherit("tags"))
+
+	s.IgnoreFields = mergeFileLists(parent.IgnoreFields, s.IgnoreFields, inherit("ignore_fields"))
+	s.MaskFields = mergeFileLists(parent.MaskFields, s.MaskFields, inherit("mask_fields"))
+
+	if inherit("ignore_lines") {
+		s.IgnoreLines = mergeLineFilters(parent.IgnoreLines, s.IgnoreLines)
+	}
+
+	if inherit("rewrites") {
+		rewrites := map[string]Rewrites{}
+		for file, parentRewrites := range parent.Rewrites {
+			rewrites[file] = mergeRewrites(parentRewrites, s.Rewrites[file])
+		}
+		for file, childRewrites := range s.Rewrites {
+			if _, exists := rewrites[file]; !exists {
+				rewrites[file] = childRewrites
+			}
+		}
+		s.Rewrites = rewrites
+	}
+
+	if inherit("variables") && len(parent.Variables) > 0 {
+		variables := map[string]interface{}{}
+		for name, value := range parent.Variables {
+			variables[name] = value
+		}
+		for name, value := range s.Variables {
+			variables[name] = value
+		}
+		s.Variables = variables
+	}
+
+	if inherit("env") {
+		s.Env = mergeMaps(parent.Env, s.Env)
+	}
+
+	if inherit("codecs") {
+		s.Codecs = mergeMaps(parent.Codecs, s.Codecs)
+	}
+
+	if inherit("isolate_env") {
+		s.IsolateEnv = s.IsolateEnv || parent.IsolateEnv
+	}
+
+	if inherit("commands") && len(s.Commands) == 0 {
+		s.Commands = parent.Commands
+	}
+
+	if inherit("steps") && len(s.Steps) == 0 {
+		s.Steps = parent.Steps
+	}
+
+	if inherit("assertions") && len(parent.Assertions) > 0 {
+		s.Assertions = append(append([]Assertion{}, parent.Assertions...), s.Assertions...)
+	}
+
+	if inherit("normalize") && len(parent.Normalize) > 0 {
+		s.Normalize = mergeNormalizers(parent.Normalize, s.Normalize)
+	}
+
+	if inherit("timeout") && s.Timeout == 0 {
+		s.Timeout = parent.Timeout
+	}
+
+	if inherit("requires_version") && len(s.RequiresVersion) == 0 {
+		s.RequiresVersion = parent.RequiresVersion
+	}
+
+	return nil
+}
+
+// mergeNormalizers returns the parent normalizers followed by the child
+// normalizers, where a child normalizer with the same name as a parent
+// normalizer replaces it in place.
+func mergeNormalizers(parent, child []Normalizer) []Normalizer {
+	merged := append([]Normalizer{}, parent...)
+	for _, normalizer := range child {
+		replaced := false
+		for ix := range merged {
+			if merged[ix].Name == normalizer.Name {
+				merged[ix] = normalizer
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, normalizer)
+		}
+	}
+	return merged
+}
+
+// mergeFileLists merges maps from file names to lists of strings, such as
+// IgnoreFields, by merging the lists for each file with mergeLists.
+func mergeFileLists(parent, child map[string][]string, inherit bool) map[string][]string {
+	if parent == nil && child == nil {
+		return nil
+	}
+
+	merged := map[string][]string{}
+	if inherit {
+		for file, entries := range parent {
+			merged[file] = mergeLists(entries, child[file], true)
+		}
+	}
+	for file, entries := range child {
+		if _, exists := merged[file]; !exists {
+			merged[file] = mergeLists(nil, entries, false)
+		}
+	}
+	return merged
+}
+
+// mergeLists returns the parent entries followed by the child entries, with
+// duplicates removed. Any child entries prefixed with ! remove the matching
+// parent entry and are not included in the result.
+//
+// If inherit is false, the parent entries are ignored completely.
+func mergeLists(parent, child []string, inherit bool) []string {
+	removed := map[string]bool{}
+	for _, entry := range child {
+		if strings.HasPrefix(entry, "!") {
+			removed[strings.TrimPrefix(entry, "!")] = true
+		}
+	}
+
+	var merged []string
+	seen := map[string]bool{}
+	add := func(entry string) {
+		if removed[entry] || seen[entry] {
+			return
+		}
+		seen[entry] = true
+		merged = append(merged, entry)
+	}
+
+	if inherit {
+		for _, entry := range parent {
+			add(entry)
+		}
+	}
+	for _, entry := range child {
+		if !strings.HasPrefix(entry, "!") {
+			add(entry)
+		}
+	}
+	return merged
+}
+
+// mergeMaps returns a new map containing the entries of both maps, preferring
+// the child value where both maps contain the same key.
+func mergeMaps(parent, child map[string]string) map[string]string {
+	if parent == nil && child == nil {
+		return nil
+	}
+
+	merged := map[string]string{}
+	for key, value := range parent {
+		merged[key] = value
+	}
+	for key, value := range child {
+		merged[key] = value
+	}
+	return merged
 }
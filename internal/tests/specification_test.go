@@ -0,0 +1,298 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/opentofu/equivalence-testing/internal/binary"
+	"github.com/opentofu/equivalence-testing/internal/files"
+)
+
+func TestSpecificationInherit(t *testing.T) {
+	parent := TestSpecification{
+		IncludeFiles: []string{"one.json", "two.json"},
+		IgnoreFields: map[string][]string{
+			"plan.json":  {"errored", "format_version"},
+			"state.json": {"format_version"},
+		},
+		Rewrites: map[string]Rewrites{
+			"plan": {{From: "Terraform", To: "OpenTF"}, {From: "terraform", To: "opentf"}},
+		},
+		Env:        map[string]string{"TF_LOG": "", "A": "parent"},
+		IsolateEnv: true,
+		Commands: []binary.Command{
+			{Name: "init", Arguments: []string{"init"}},
+		},
+	}
+
+	tcs := map[string]struct {
+		child    TestSpecification
+		expected TestSpecification
+	}{
+		"empty": {
+			child: TestSpecification{},
+			expected: TestSpecification{
+				IncludeFiles: []string{"one.json", "two.json"},
+				IgnoreFields: map[string][]string{
+					"plan.json":  {"errored", "format_version"},
+					"state.json": {"format_version"},
+				},
+				Rewrites: map[string]Rewrites{
+					"plan": {{From: "Terraform", To: "OpenTF"}, {From: "terraform", To: "opentf"}},
+				},
+				Env:        map[string]string{"TF_LOG": "", "A": "parent"},
+				IsolateEnv: true,
+				Commands: []binary.Command{
+					{Name: "init", Arguments: []string{"init"}},
+				},
+			},
+		},
+		"merged": {
+			child: TestSpecification{
+				IncludeFiles: []string{"two.json", "three.json", "!one.json"},
+				IgnoreFields: map[string][]string{
+					"plan.json":  {"!format_version", "timestamp"},
+					"apply.json": {"0"},
+				},
+				Rewrites: map[string]Rewrites{
+					"plan": {{From: "terraform", To: "tofu"}, {From: "OpenTF", To: "OpenTofu"}},
+				},
+				Env: map[string]string{"A": "child"},
+				Commands: []binary.Command{
+					{Name: "plan", Arguments: []string{"plan"}},
+				},
+			},
+			expected: TestSpecification{
+				IncludeFiles: []string{"two.json", "three.json"},
+				IgnoreFields: map[string][]string{
+					"plan.json":  {"errored", "timestamp"},
+					"state.json": {"format_version"},
+					"apply.json": {"0"},
+				},
+				Rewrites: map[string]Rewrites{
+					"plan": {{From: "Terraform", To: "OpenTF"}, {From: "terraform", To: "tofu"}, {From: "OpenTF", To: "OpenTofu"}},
+				},
+				Env:        map[string]string{"TF_LOG": "", "A": "child"},
+				IsolateEnv: true,
+				Commands: []binary.Command{
+					{Name: "plan", Arguments: []string{"plan"}},
+				},
+			},
+		},
+		"no_inherit": {
+			child: TestSpecification{
+				IncludeFiles: []string{"!one.json"},
+				NoInherit:    []string{"include_files", "ignore_fields", "isolate_env", "commands"},
+			},
+			expected: TestSpecification{
+				IgnoreFields: map[string][]string{},
+				Rewrites: map[string]Rewrites{
+					"plan": {{From: "Terraform", To: "OpenTF"}, {From: "terraform", To: "opentf"}},
+				},
+				Env:       map[string]string{"TF_LOG": "", "A": "parent"},
+				NoInherit: []string{"include_files", "ignore_fields", "isolate_env", "commands"},
+			},
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			child := tc.child
+			if err := child.Inherit(parent); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if diff := cmp.Diff(tc.expected, child); len(diff) > 0 {
+				t.Errorf("unexpected specification: %s", diff)
+			}
+		})
+	}
+}
+
+func TestSpecificationInheritInvalidField(t *testing.T) {
+	child := TestSpecification{
+		NoInherit: []string{"unknown"},
+	}
+	if err := child.Inherit(TestSpecification{}); err == nil {
+		t.Errorf("expected an error for an unknown field")
+	}
+}
+
+func TestSpecificationSupportsVersion(t *testing.T) {
+	tcs := map[string]struct {
+		requiresVersion string
+		binaryVersion   string
+		expected        bool
+		err             bool
+	}{
+		"unset": {
+			binaryVersion: "1.6.0",
+			expected:      true,
+		},
+		"satisfied": {
+			requiresVersion: ">= 1.6.0, < 1.8.0",
+			binaryVersion:   "1.7.2",
+			expected:        true,
+		},
+		"unsatisfied": {
+			requiresVersion: ">= 1.6.0, < 1.8.0",
+			binaryVersion:   "1.8.0",
+			expected:        false,
+		},
+		"prerelease": {
+			requiresVersion: ">= 1.6.0",
+			binaryVersion:   "1.7.0-dev",
+			expected:        true,
+		},
+		"alpha": {
+			requiresVersion: ">= 1.6.0",
+			binaryVersion:   "1.7.0-alpha1",
+			expected:        true,
+		},
+		"prerelease with metadata": {
+			requiresVersion: "~> 1.7.0",
+			binaryVersion:   "1.7.0-rc1+abc",
+			expected:        true,
+		},
+		"prerelease unsatisfied": {
+			requiresVersion: ">= 1.6.0, < 1.8.0",
+			binaryVersion:   "1.8.0-beta1",
+			expected:        false,
+		},
+		"invalid constraint": {
+			requiresVersion: ">= bacon",
+			binaryVersion:   "1.6.0",
+			err:             true,
+		},
+		"invalid binary version": {
+			requiresVersion: ">= 1.6.0",
+			binaryVersion:   "bacon",
+			err:             true,
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			specification := TestSpecification{RequiresVersion: tc.requiresVersion}
+
+			supported, err := specification.SupportsVersion(tc.binaryVersion)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected an error but found none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if supported != tc.expected {
+				t.Errorf("expected %t but found %t", tc.expected, supported)
+			}
+		})
+	}
+}
+
+func TestValidateVarFiles(t *testing.T) {
+	custom := []binary.Command{{Name: "plan", Arguments: []string{"plan"}}}
+
+	tcs := map[string]struct {
+		specification TestSpecification
+		err           bool
+	}{
+		"default commands": {
+			specification: TestSpecification{VarFiles: []string{"test.tfvars"}},
+		},
+		"custom commands": {
+			specification: TestSpecification{VarFiles: []string{"test.tfvars"}, Commands: custom},
+			err:           true,
+		},
+		"custom commands without var_files": {
+			specification: TestSpecification{Commands: custom},
+		},
+		"step with default commands": {
+			specification: TestSpecification{
+				VarFiles: []string{"test.tfvars"},
+				Steps:    []TestStep{{Commands: custom}, {}},
+			},
+		},
+		"every step with custom commands": {
+			specification: TestSpecification{
+				VarFiles: []string{"test.tfvars"},
+				Steps:    []TestStep{{Commands: custom}, {Commands: custom}},
+			},
+			err: true,
+		},
+		"steps falling back to custom commands": {
+			specification: TestSpecification{
+				VarFiles: []string{"test.tfvars"},
+				Commands: custom,
+				Steps:    []TestStep{{}, {}},
+			},
+			err: true,
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			err := tc.specification.ValidateVarFiles()
+			if tc.err && err == nil {
+				t.Errorf("expected an error but found none")
+			}
+			if !tc.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateFields(t *testing.T) {
+	specification := TestSpecification{
+		IgnoreFields: map[string][]string{
+			"plan.json": {`resource_changes[address=null_resource.x]`, `"a.b"`},
+		},
+		MaskFields: map[string][]string{
+			"state.json": {"values..id"},
+		},
+	}
+
+	err := specification.ValidateFields()
+	if err == nil {
+		t.Fatalf("expected an error for an invalid field")
+	}
+
+	expected := `mask_fields for state.json: invalid field "values..id": empty segment at position 7`
+	if err.Error() != expected {
+		t.Errorf("expected %q, found %q", expected, err.Error())
+	}
+}
+
+func TestOutputWarnings(t *testing.T) {
+	output := TestOutput{
+		Test: Test{
+			Specification: TestSpecification{
+				IgnoreFields: map[string][]string{
+					"plan.json": {"resource_changes.5", "resource_changes.-1"},
+				},
+			},
+		},
+		files: map[string]*files.File{
+			"plan.json": jsonFile(t, `{"resource_changes": [{"address": "a"}, {"address": "b"}]}`),
+		},
+	}
+
+	warnings, err := output.Warnings()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		`plan.json: field "resource_changes.5": index 5 is out of range for an array of 2 element(s), skipping`,
+	}
+	if diff := cmp.Diff(expected, warnings); len(diff) > 0 {
+		t.Errorf("unexpected warnings:\n%s", diff)
+	}
+}
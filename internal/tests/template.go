@@ -0,0 +1,127 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/opentofu/equivalence-testing/internal/binary"
+)
+
+// TemplateData contains the values that can be referenced by placeholders in
+// the command arguments, file names (output, stderr and exit code), and
+// environment variables of a test specification. For example, `{{.TestName}}`
+// or `{{.Variables.name}}`.
+type TemplateData struct {
+	// TestName is the name of the test being executed.
+	TestName string
+
+	// TestDir is the absolute or relative path to the directory containing
+	// the test case.
+	TestDir string
+
+	// WorkDir is the path to the temporary directory the test is executed in.
+	WorkDir string
+
+	// PlanFile is the name of the plan file written by the default plan
+	// command, relative to WorkDir.
+	PlanFile string
+
+	// Step is the number of the step being executed, starting at 1. Tests
+	// without any steps are treated as a single step.
+	Step int
+
+	// Variables contains the input variables from the test specification.
+	Variables map[string]interface{}
+}
+
+// ValidateTemplates checks that every placeholder within the specification
+// references a known value, and returns an error for the first one that
+// doesn't.
+func (s TestSpecification) ValidateTemplates() error {
+	data := TemplateData{
+		Variables: s.Variables,
+	}
+
+	if _, err := expandEnv(s.Env, data); err != nil {
+		return err
+	}
+	if _, err := expandCommands(s.Commands, data); err != nil {
+		return err
+	}
+	for ix, step := range s.Steps {
+		if _, err := expandCommands(step.Commands, data); err != nil {
+			return fmt.Errorf("step %d: %w", ix+1, err)
+		}
+	}
+	return nil
+}
+
+// expandCommands returns a copy of commands with all the placeholders in the
+// arguments, file names, and environment variables expanded.
+func expandCommands(commands []binary.Command, data TemplateData) ([]binary.Command, error) {
+	var expanded []binary.Command
+	for _, command := range commands {
+		var err error
+
+		var arguments []string
+		for _, argument := range command.Arguments {
+			if argument, err = expand(argument, data); err != nil {
+				return nil, fmt.Errorf("command (%s): %w", command.Name, err)
+			}
+			arguments = append(arguments, argument)
+		}
+		command.Arguments = arguments
+
+		for _, name := range []*string{&command.OutputFileName, &command.StderrFileName, &command.ExitCodeFileName} {
+			if *name, err = expand(*name, data); err != nil {
+				return nil, fmt.Errorf("command (%s): %w", command.Name, err)
+			}
+		}
+
+		if command.Env, err = expandEnv(command.Env, data); err != nil {
+			return nil, fmt.Errorf("command (%s): %w", command.Name, err)
+		}
+
+		expanded = append(expanded, command)
+	}
+	return expanded, nil
+}
+
+// expandEnv returns a copy of env with all the placeholders in the values
+// expanded.
+func expandEnv(env map[string]string, data TemplateData) (map[string]string, error) {
+	if env == nil {
+		return nil, nil
+	}
+
+	expanded := map[string]string{}
+	for name, value := range env {
+		var err error
+		if expanded[name], err = expand(value, data); err != nil {
+			return nil, fmt.Errorf("env (%s): %w", name, err)
+		}
+	}
+	return expanded, nil
+}
+
+func expand(value string, data TemplateData) (string, error) {
+	if !strings.Contains(value, "{{") {
+		// Skip the overhead of parsing a template for the common case.
+		return value, nil
+	}
+
+	tmpl, err := template.New("value").Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid placeholder in %q: %w", value, err)
+	}
+
+	var builder strings.Builder
+	if err := tmpl.Execute(&builder, data); err != nil {
+		return "", fmt.Errorf("invalid placeholder in %q: %w", value, err)
+	}
+	return builder.String(), nil
+}
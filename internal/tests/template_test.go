@@ -0,0 +1,156 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/opentofu/equivalence-testing/internal/binary"
+)
+
+func TestValidateTemplates(t *testing.T) {
+	tcs := map[string]struct {
+		specification TestSpecification
+		err           string
+	}{
+		"no placeholders": {
+			specification: TestSpecification{
+				Commands: []binary.Command{{Name: "plan", Arguments: []string{"plan"}}},
+			},
+		},
+		"known placeholders": {
+			specification: TestSpecification{
+				Variables: map[string]interface{}{"name": "value"},
+				Env:       map[string]string{"NAME": "{{.Variables.name}}"},
+				Commands: []binary.Command{
+					{
+						Name:             "plan",
+						Arguments:        []string{"plan", "-out={{.PlanFile}}"},
+						OutputFileName:   "{{.TestName}}.out",
+						StderrFileName:   "step_{{.Step}}.stderr",
+						ExitCodeFileName: "{{.Step}}.exit",
+						Env:              map[string]string{"DIR": "{{.WorkDir}}"},
+					},
+				},
+			},
+		},
+		"unknown field": {
+			specification: TestSpecification{
+				Commands: []binary.Command{{Name: "plan", Arguments: []string{"{{.Bacon}}"}}},
+			},
+			err: "command (plan): invalid placeholder",
+		},
+		"unknown variable": {
+			specification: TestSpecification{
+				Variables: map[string]interface{}{"name": "value"},
+				Env:       map[string]string{"NAME": "{{.Variables.other}}"},
+			},
+			err: "env (NAME): invalid placeholder",
+		},
+		"unknown variable in output file name": {
+			specification: TestSpecification{
+				Commands: []binary.Command{{Name: "show", OutputFileName: "{{.Variables.name}}.json"}},
+			},
+			err: "command (show): invalid placeholder",
+		},
+		"unknown variable in stderr file name": {
+			specification: TestSpecification{
+				Commands: []binary.Command{{Name: "show", StderrFileName: "{{.Variables.name}}"}},
+			},
+			err: "command (show): invalid placeholder",
+		},
+		"unknown variable in exit code file name": {
+			specification: TestSpecification{
+				Commands: []binary.Command{{Name: "show", ExitCodeFileName: "{{.Variables.name}}"}},
+			},
+			err: "command (show): invalid placeholder",
+		},
+		"unknown variable in step": {
+			specification: TestSpecification{
+				Steps: []TestStep{
+					{},
+					{Commands: []binary.Command{{Name: "apply", Env: map[string]string{"X": "{{.Variables.name}}"}}}},
+				},
+			},
+			err: "step 2: command (apply): env (X): invalid placeholder",
+		},
+		"malformed": {
+			specification: TestSpecification{
+				Commands: []binary.Command{{Name: "plan", Arguments: []string{"{{.TestName"}}},
+			},
+			err: "command (plan): invalid placeholder",
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			err := tc.specification.ValidateTemplates()
+			if len(tc.err) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("expected an error containing %q", tc.err)
+			}
+			if !strings.HasPrefix(err.Error(), tc.err) {
+				t.Errorf("expected an error starting with %q, got %q", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestExpandCommands(t *testing.T) {
+	data := TemplateData{
+		TestName:  "simple",
+		TestDir:   "tests/simple",
+		WorkDir:   "/tmp/work",
+		PlanFile:  "equivalence_test_plan",
+		Step:      2,
+		Variables: map[string]interface{}{"name": "value"},
+	}
+
+	tcs := map[string]struct {
+		command  binary.Command
+		expected binary.Command
+	}{
+		"arguments": {
+			command:  binary.Command{Name: "plan", Arguments: []string{"plan", "-out={{.PlanFile}}", "{{.TestDir}}"}},
+			expected: binary.Command{Name: "plan", Arguments: []string{"plan", "-out=equivalence_test_plan", "tests/simple"}},
+		},
+		"output file name": {
+			command:  binary.Command{Name: "show", OutputFileName: "{{.TestName}}_{{.Step}}.json"},
+			expected: binary.Command{Name: "show", OutputFileName: "simple_2.json"},
+		},
+		"stderr file name": {
+			command:  binary.Command{Name: "show", StderrFileName: "{{.Variables.name}}.stderr"},
+			expected: binary.Command{Name: "show", StderrFileName: "value.stderr"},
+		},
+		"exit code file name": {
+			command:  binary.Command{Name: "apply", ExpectFailure: true, ExitCodeFileName: "step_{{.Step}}.exit"},
+			expected: binary.Command{Name: "apply", ExpectFailure: true, ExitCodeFileName: "step_2.exit"},
+		},
+		"env": {
+			command:  binary.Command{Name: "plan", Env: map[string]string{"DIR": "{{.WorkDir}}", "PLAIN": "x"}},
+			expected: binary.Command{Name: "plan", Env: map[string]string{"DIR": "/tmp/work", "PLAIN": "x"}},
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			expanded, err := expandCommands([]binary.Command{tc.command}, data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff([]binary.Command{tc.expected}, expanded); len(diff) > 0 {
+				t.Errorf("unexpected commands:\n%s", diff)
+			}
+		})
+	}
+}
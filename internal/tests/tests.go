@@ -5,10 +5,16 @@ package tests
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/hashicorp/go-version"
 	"github.com/komkom/jsonc/jsonc"
 
 	"github.com/opentofu/equivalence-testing/internal/binary"
@@ -18,11 +24,13 @@ import (
 // Test defines a single equivalence test within our framework.
 //
 // Each test has a Name that references the directory that contains our testing
-// data. Within this directory there should be a `spec.json` file which is
-// read in the TestSpecification object.
+// data. Within this directory there should be a `spec.json` or `spec.hcl` file
+// which is read in the TestSpecification object.
 //
-// The Directory variable references the parent directory of the test, so the
+// The Directory variable references the root directory of the tests, so the
 // full path for a given test case is paths.Join(test.Directory, test.Name).
+// Test cases can be grouped into nested directories, in which case the Name
+// contains the path of the test relative to Directory (eg. group/test).
 type Test struct {
 	Name          string
 	Directory     string
@@ -40,71 +48,358 @@ func contains(test string, filters []string) bool {
 
 // ReadFrom accepts a directory and returns the set of test cases specified
 // within this directory.
-func ReadFrom(directory string, globalRewrites map[string]map[string]string, filters ...string) ([]Test, error) {
-	files, err := os.ReadDir(directory)
+//
+// Any subdirectory that contains a `spec.json` or `spec.hcl` file is a test
+// case. Any other subdirectory is searched for further test cases. A
+// `defaults.json` or `defaults.hcl` file in the root directory, or any of the
+// subdirectories that aren't test cases, is inherited by all the test cases
+// beneath it. See TestSpecification.Inherit for details on how the
+// specifications are merged.
+//
+// Only the test cases chosen by the selector are returned.
+func ReadFrom(directory string, globalRewrites map[string]Rewrites, selector Selector) ([]Test, error) {
+	if err := selector.Validate(); err != nil {
+		return nil, err
+	}
+	return readFrom(directory, "", TestSpecification{}, globalRewrites, selector)
+}
+
+func readFrom(directory, relative string, defaults TestSpecification, globalRewrites map[string]Rewrites, selector Selector) ([]Test, error) {
+	current := path.Join(directory, relative)
+
+	if file, err := FindSpecification(current, "defaults"); err == nil {
+		specification, err := ReadSpecification(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := specification.Inherit(defaults); err != nil {
+			return nil, fmt.Errorf("invalid defaults in %s: %w", current, err)
+		}
+		defaults = specification
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	files, err := os.ReadDir(current)
 	if err != nil {
 		return nil, err
 	}
 
 	var tests []Test
 	for _, file := range files {
-		if file.IsDir() {
-			if len(filters) == 0 || contains(file.Name(), filters) {
-				data, err := os.ReadFile(path.Join(directory, file.Name(), "spec.json"))
-				if err != nil {
-					return nil, err
-				}
-
-				var specification TestSpecification
-
-				decoder, err := jsonc.NewDecoder(bytes.NewReader(data))
-				if err != nil {
-					return nil, err
-				}
-
-				if err := decoder.Decode(&specification); err != nil {
-					return nil, err
-				}
-
-				specification.AddRewrites(globalRewrites)
-
-				tests = append(tests, Test{
-					Name:          file.Name(),
-					Specification: specification,
-					Directory:     directory,
-				})
+		if !file.IsDir() {
+			continue
+		}
+
+		name := path.Join(relative, file.Name())
+		file, err := FindSpecification(path.Join(directory, name), "spec")
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+
+			// Then this directory isn't a test case, so it might contain
+			// test cases of its own.
+			nested, err := readFrom(directory, name, defaults, globalRewrites, selector)
+			if err != nil {
+				return nil, err
+			}
+			tests = append(tests, nested...)
+			continue
+		}
+
+		// We check the name first, so we don't need to read the
+		// specification of tests that definitely aren't selected.
+		if !selector.SelectsName(name) {
+			continue
+		}
+
+		specification, err := ReadSpecification(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := specification.Inherit(defaults); err != nil {
+			return nil, fmt.Errorf("invalid specification for %s: %w", name, err)
+		}
+		specification.AddRewrites(globalRewrites)
+
+		if err := specification.ValidateTemplates(); err != nil {
+			return nil, fmt.Errorf("invalid specification for %s: %w", name, err)
+		}
+
+		if err := specification.ValidateAssertions(); err != nil {
+			return nil, fmt.Errorf("invalid specification for %s: %w", name, err)
+		}
+
+		if err := specification.ValidateFields(); err != nil {
+			return nil, fmt.Errorf("invalid specification for %s: %w", name, err)
+		}
+
+		if err := specification.ValidateRewrites(); err != nil {
+			return nil, fmt.Errorf("invalid specification for %s: %w", name, err)
+		}
+
+		if err := specification.ValidateLineFilters(); err != nil {
+			return nil, fmt.Errorf("invalid specification for %s: %w", name, err)
+		}
+
+		if err := specification.ValidateNormalizers(); err != nil {
+			return nil, fmt.Errorf("invalid specification for %s: %w", name, err)
+		}
+
+		if err := specification.ValidateCodecs(); err != nil {
+			return nil, fmt.Errorf("invalid specification for %s: %w", name, err)
+		}
+
+		if err := specification.ValidateVarFiles(); err != nil {
+			return nil, fmt.Errorf("invalid specification for %s: %w", name, err)
+		}
+
+		if err := specification.IncludePatterns().Validate(); err != nil {
+			return nil, fmt.Errorf("invalid specification for %s: %w", name, err)
+		}
+
+		if len(specification.RequiresVersion) > 0 {
+			if _, err := version.NewConstraint(specification.RequiresVersion); err != nil {
+				return nil, fmt.Errorf("invalid specification for %s: invalid requires_version %q: %w", name, specification.RequiresVersion, err)
 			}
 		}
+
+		test := Test{
+			Name:          name,
+			Specification: specification,
+			Directory:     directory,
+		}
+		if selector.Selects(test) {
+			tests = append(tests, test)
+		}
 	}
 	return tests, nil
 }
 
+// FindSpecification returns the path to the specification file with the given
+// base name (eg. spec or defaults) within directory. The specification can be
+// written in JSON (spec.json) or HCL (spec.hcl), but not both.
+//
+// If neither file exists, the returned error satisfies os.IsNotExist.
+func FindSpecification(directory, base string) (string, error) {
+	var found []string
+	for _, ext := range []string{".json", ".hcl"} {
+		file := path.Join(directory, base+ext)
+		if _, err := os.Stat(file); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", err
+		}
+		found = append(found, file)
+	}
+
+	switch len(found) {
+	case 0:
+		return "", &os.PathError{Op: "stat", Path: path.Join(directory, base+".json"), Err: os.ErrNotExist}
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("found both %s and %s, only one can be used", found[0], found[1])
+	}
+}
+
+// ReadSpecification reads a test specification from a file. Files with the
+// .hcl extension are parsed as HCL, and every other file is parsed as JSONC.
+// Both formats are validated against the schema returned by
+// SpecificationSchema.
+func ReadSpecification(file string) (TestSpecification, error) {
+	var specification TestSpecification
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return specification, err
+	}
+
+	if filepath.Ext(file) == ".hcl" {
+		return ParseHCLSpecification(data, file)
+	}
+
+	// We decode the file twice, first into a generic value so we can check
+	// it against the schema, and then into the specification itself. The
+	// schema catches mistakes like unknown or misspelled fields that the
+	// decoder would otherwise silently ignore.
+	var value interface{}
+	if err := decodeJsonc(data, &value); err != nil {
+		return specification, fmt.Errorf("could not parse %s: %w", file, err)
+	}
+
+	if errs := SpecificationSchema().Validate(value); len(errs) > 0 {
+		var messages []string
+		for _, err := range errs {
+			messages = append(messages, fmt.Sprintf("%s: %v", file, err))
+		}
+		return specification, errors.New(strings.Join(messages, "\n"))
+	}
+
+	if err := decodeJsonc(data, &specification); err != nil {
+		return specification, fmt.Errorf("could not parse %s: %w", file, err)
+	}
+	return specification, nil
+}
+
+func decodeJsonc(data []byte, target interface{}) error {
+	decoder, err := jsonc.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(target)
+}
+
+// tempName converts the name of a test into a pattern that can be used with
+// os.MkdirTemp, which doesn't accept path separators.
+func tempName(name string) string {
+	return strings.ReplaceAll(name, "/", "_")
+}
+
 // RunWith executes the specified test using the binary specified by
 // the binary.Binary argument.
 //
 // This function will return a TestOutput struct, which contains the file names
 // of the outputs that we want to compare. These files are already read in and
 // parsed in JSON objects.
-func (test Test) RunWith(tf binary.Binary) (TestOutput, error) {
-	tmp, err := os.MkdirTemp(test.Directory, test.Name)
+//
+// If the test has multiple steps, the outputs of each step are prefixed with
+// the step_N directory of the step that produced them.
+//
+// If ctx is cancelled, the running command is interrupted and no further
+// commands or steps are executed. The temporary directories for the test are
+// always removed before RunWith returns.
+func (test Test) RunWith(ctx context.Context, tf binary.Binary) (TestOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return TestOutput{}, err
+	}
+
+	tmp, err := os.MkdirTemp(test.Directory, tempName(test.Name))
 	if err != nil {
 		return TestOutput{}, err
 	}
 	defer os.RemoveAll(tmp)
 
+	// We don't copy the overlays for each step into the working directory,
+	// they are copied over the top of the working directory as each step
+	// executes.
+	skipFiles := []string{"spec.json", "spec.hcl"}
+	for _, step := range test.Specification.Steps {
+		if len(step.Directory) > 0 {
+			skipFiles = append(skipFiles, strings.Split(filepath.ToSlash(path.Clean(step.Directory)), "/")[0])
+		}
+	}
+
 	testDirectory := path.Join(test.Directory, test.Name)
-	if err = filepath.WalkDir(testDirectory, files.CopyDir(testDirectory, tmp, []string{"spec.json"})); err != nil {
+	if err = filepath.WalkDir(testDirectory, files.CopyDir(testDirectory, tmp, skipFiles)); err != nil {
 		return TestOutput{}, err
 	}
 
-	files, err := tf.ExecuteTest(tmp, test.Specification.IncludeFiles, test.Specification.Commands...)
+	options := test.Specification.Options()
+	if test.Specification.Timeout > 0 {
+		options.Deadline = time.Now().Add(time.Duration(test.Specification.Timeout))
+	}
 
-	if err != nil {
-		return TestOutput{}, err
+	if len(test.Specification.Steps) == 0 {
+		options, commands, err := test.expand(options, test.Specification.Commands, tmp, 0)
+		if err != nil {
+			return TestOutput{}, err
+		}
+
+		files, err := tf.ExecuteTest(ctx, tmp, options, test.Specification.IncludePatterns(), commands...)
+		if err != nil {
+			return TestOutput{}, err
+		}
+
+		return TestOutput{
+			Test:      test,
+			Flavor:    tf.Flavor(),
+			Version:   tf.Version(),
+			files:     files,
+			processed: &processedOutput{},
+		}, nil
+	}
+
+	if options.IsolateEnv {
+		// Every step should share the same isolated directories, otherwise
+		// each step would lose the data directory of the previous step.
+		if options.IsolatedDirectory, err = os.MkdirTemp("", tempName(test.Name)); err != nil {
+			return TestOutput{}, err
+		}
+		defer os.RemoveAll(options.IsolatedDirectory)
+	}
+
+	outputs := map[string]*files.File{}
+	for ix, step := range test.Specification.Steps {
+		if len(step.Directory) > 0 {
+			stepDirectory := path.Join(testDirectory, step.Directory)
+			if err = filepath.WalkDir(stepDirectory, files.CopyDir(stepDirectory, tmp, nil)); err != nil {
+				return TestOutput{}, fmt.Errorf("could not copy directory for step %d: %w", ix+1, err)
+			}
+		}
+
+		for _, file := range step.RemoveFiles {
+			if err := os.RemoveAll(path.Join(tmp, file)); err != nil {
+				return TestOutput{}, fmt.Errorf("could not remove file for step %d: %w", ix+1, err)
+			}
+		}
+
+		commands := step.Commands
+		if len(commands) == 0 {
+			commands = test.Specification.Commands
+		}
+
+		options, commands, err := test.expand(options, commands, tmp, ix)
+		if err != nil {
+			return TestOutput{}, err
+		}
+
+		stepFiles, err := tf.ExecuteTest(ctx, tmp, options, test.Specification.IncludePatterns(), commands...)
+		if err != nil {
+			return TestOutput{}, err
+		}
+
+		for name, file := range stepFiles {
+			outputs[path.Join(StepDirectory(ix), name)] = file
+		}
 	}
 
 	return TestOutput{
-		Test:  test,
-		files: files,
+		Test:      test,
+		Flavor:    tf.Flavor(),
+		Version:   tf.Version(),
+		files:     outputs,
+		processed: &processedOutput{},
 	}, nil
 }
+
+// expand replaces the placeholders in the environment variables and commands
+// for the step at index ix with their actual values.
+func (test Test) expand(options binary.Options, commands []binary.Command, workDir string, ix int) (binary.Options, []binary.Command, error) {
+	data := TemplateData{
+		TestName:  test.Name,
+		TestDir:   path.Join(test.Directory, test.Name),
+		WorkDir:   workDir,
+		PlanFile:  binary.PlanFile,
+		Step:      ix + 1,
+		Variables: test.Specification.Variables,
+	}
+
+	var err error
+	if options.Env, err = expandEnv(options.Env, data); err != nil {
+		return options, nil, err
+	}
+	if commands, err = expandCommands(commands, data); err != nil {
+		return options, nil, err
+	}
+	return options, commands, nil
+}
+
+// StepDirectory returns the name of the directory that the outputs of the
+// step at index ix are written into.
+func StepDirectory(ix int) string {
+	return fmt.Sprintf("step_%d", ix+1)
+}
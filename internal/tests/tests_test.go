@@ -0,0 +1,218 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/opentofu/equivalence-testing/internal/binary"
+	"github.com/opentofu/equivalence-testing/internal/files"
+)
+
+// stubBinary is a binary.Binary that records what it was asked to execute
+// instead of executing anything.
+type stubBinary struct {
+	// directories records the working directory of each call to ExecuteTest.
+	directories []string
+
+	// contents records the files within the working directory, and their
+	// contents, at the start of each call to ExecuteTest.
+	contents []map[string]string
+
+	// commands records the commands passed into each call to ExecuteTest.
+	commands [][]binary.Command
+}
+
+var _ binary.Binary = (*stubBinary)(nil)
+
+func (b *stubBinary) ExecuteTest(ctx context.Context, directory string, options binary.Options, includeFiles files.Patterns, commands ...binary.Command) (map[string]*files.File, error) {
+	contents := map[string]string{}
+	err := filepath.WalkDir(directory, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(directory, file)
+		if err != nil {
+			return err
+		}
+		contents[filepath.ToSlash(relative)] = string(data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b.directories = append(b.directories, directory)
+	b.contents = append(b.contents, contents)
+	b.commands = append(b.commands, commands)
+
+	return map[string]*files.File{
+		"output": files.NewRawFile(fmt.Sprintf("call %d", len(b.commands))),
+	}, nil
+}
+
+func (b *stubBinary) Version() string {
+	return "1.6.0"
+}
+
+func (b *stubBinary) Flavor() string {
+	return "stub"
+}
+
+// writeFiles writes each of the files into directory, creating any parent
+// directories they need.
+func writeFiles(t *testing.T, directory string, contents map[string]string) {
+	t.Helper()
+
+	for name, data := range contents {
+		file := path.Join(directory, name)
+		if err := os.MkdirAll(path.Dir(file), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(data), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRunWithSteps(t *testing.T) {
+	directory := t.TempDir()
+	writeFiles(t, path.Join(directory, "steps"), map[string]string{
+		"spec.json":             `{}`,
+		"main.tf":               "v1",
+		"step_2/main.tf":        "v2",
+		"step_2/extra.tf":       "extra",
+		"overlays/three/new.tf": "new",
+	})
+
+	test := Test{
+		Name:      "steps",
+		Directory: directory,
+		Specification: TestSpecification{
+			Commands: []binary.Command{
+				{Name: "plan", Arguments: []string{"plan"}},
+			},
+			Steps: []TestStep{
+				{},
+				{
+					Directory: "step_2",
+					Commands: []binary.Command{
+						{Name: "apply", Arguments: []string{"apply", "{{.Step}}"}},
+					},
+				},
+				{
+					Directory:   "overlays/three",
+					RemoveFiles: []string{"extra.tf"},
+				},
+			},
+		},
+	}
+
+	tf := &stubBinary{}
+	output, err := test.RunWith(context.Background(), tf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The spec file and the step directories aren't copied into the working
+	// directory, each step copies its own directory over the top of the
+	// files left by the previous step instead.
+	expectedContents := []map[string]string{
+		{"main.tf": "v1"},
+		{"main.tf": "v2", "extra.tf": "extra"},
+		{"main.tf": "v2", "new.tf": "new"},
+	}
+	if diff := cmp.Diff(expectedContents, tf.contents); len(diff) > 0 {
+		t.Errorf("unexpected working directory contents:\n%s", diff)
+	}
+
+	// Steps without commands fall back to the commands of the test.
+	expectedCommands := [][]binary.Command{
+		{{Name: "plan", Arguments: []string{"plan"}}},
+		{{Name: "apply", Arguments: []string{"apply", "2"}}},
+		{{Name: "plan", Arguments: []string{"plan"}}},
+	}
+	if diff := cmp.Diff(expectedCommands, tf.commands); len(diff) > 0 {
+		t.Errorf("unexpected commands:\n%s", diff)
+	}
+
+	for _, directory := range tf.directories {
+		if directory != tf.directories[0] {
+			t.Errorf("expected every step to share a working directory, found %s and %s", tf.directories[0], directory)
+		}
+	}
+	if _, err := os.Stat(tf.directories[0]); !os.IsNotExist(err) {
+		t.Errorf("expected the working directory to be removed, found %v", err)
+	}
+
+	expectedFiles := map[string]string{
+		"step_1/output": "call 1",
+		"step_2/output": "call 2",
+		"step_3/output": "call 3",
+	}
+	actualFiles := map[string]string{}
+	for name, file := range output.files {
+		actualFiles[name], _ = file.String()
+	}
+	if diff := cmp.Diff(expectedFiles, actualFiles); len(diff) > 0 {
+		t.Errorf("unexpected outputs:\n%s", diff)
+	}
+}
+
+func TestRunWithoutSteps(t *testing.T) {
+	directory := t.TempDir()
+	writeFiles(t, path.Join(directory, "simple"), map[string]string{
+		"spec.json": `{}`,
+		"main.tf":   "v1",
+	})
+
+	test := Test{
+		Name:      "simple",
+		Directory: directory,
+	}
+
+	tf := &stubBinary{}
+	output, err := test.RunWith(context.Background(), tf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if diff := cmp.Diff([]map[string]string{{"main.tf": "v1"}}, tf.contents); len(diff) > 0 {
+		t.Errorf("unexpected working directory contents:\n%s", diff)
+	}
+
+	// The outputs of a test without steps aren't prefixed.
+	if _, ok := output.files["output"]; !ok {
+		t.Errorf("expected the output to be returned without a step prefix")
+	}
+
+	// The processed files are cached, and shared between copies of the
+	// output.
+	first, err := output.Files()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	copied := output
+	second, err := copied.Files()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first["output"] != second["output"] {
+		t.Errorf("expected the processed files to be reused")
+	}
+}
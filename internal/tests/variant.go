@@ -0,0 +1,299 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+const (
+	// VariantPrefix marks a directory within the golden files of a test as a
+	// variant of the golden files, rather than a golden file itself.
+	VariantPrefix = "@"
+)
+
+var (
+	variantName = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_-]*)?(.*)$`)
+)
+
+// variant is a set of golden files that should be used instead of the default
+// set for a particular binary flavor and/or range of binary versions.
+//
+// Variants are stored in subdirectories of the golden files for a test, named
+// with the VariantPrefix followed by an optional flavor and an optional
+// version constraint. For example, `@>=1.7`, `@tofu` or `@tofu>=1.7,<1.8`.
+type variant struct {
+	name        string
+	flavor      string
+	constraints version.Constraints
+}
+
+func parseVariant(name string) (variant, error) {
+	matches := variantName.FindStringSubmatch(strings.TrimPrefix(name, VariantPrefix))
+
+	ret := variant{
+		name:   name,
+		flavor: matches[1],
+	}
+
+	if constraint := strings.TrimSpace(matches[2]); len(constraint) > 0 {
+		var err error
+		if ret.constraints, err = version.NewConstraint(constraint); err != nil {
+			return ret, fmt.Errorf("invalid version constraint in golden variant %q: %w", name, err)
+		}
+	}
+
+	if len(ret.flavor) == 0 && len(ret.constraints) == 0 {
+		return ret, fmt.Errorf("golden variant %q must specify a flavor, a version constraint, or both", name)
+	}
+	return ret, nil
+}
+
+func (v variant) matches(flavor string, binaryVersion *version.Version) bool {
+	if len(v.flavor) > 0 && v.flavor != flavor {
+		return false
+	}
+	return v.constraints.Check(binaryVersion)
+}
+
+// specificity is the number of criteria the variant checks. Variants with
+// more criteria are more specific.
+func (v variant) specificity() int {
+	specificity := len(v.constraints)
+	if len(v.flavor) > 0 {
+		specificity++
+	}
+	return specificity
+}
+
+// preferredTo returns true if v should be selected instead of other, when both
+// variants match. The more specific variant is preferred, then the variant
+// that names a flavor, then the variant with the highest lower bound on the
+// version, and then the variant with the lowest upper bound on the version.
+//
+// If the variants can't be told apart, v is preferred.
+func (v variant) preferredTo(other variant) bool {
+	if v.specificity() != other.specificity() {
+		return v.specificity() > other.specificity()
+	}
+	if hasFlavor, otherHasFlavor := len(v.flavor) > 0, len(other.flavor) > 0; hasFlavor != otherHasFlavor {
+		return hasFlavor
+	}
+
+	lower, upper := v.bounds()
+	otherLower, otherUpper := other.bounds()
+	if compare := lower.compare(otherLower, false); compare != 0 {
+		return compare > 0
+	}
+	if compare := upper.compare(otherUpper, true); compare != 0 {
+		return compare < 0
+	}
+	return true
+}
+
+// bound is one end of the range of versions accepted by a variant. A nil
+// version means the range is unbounded at that end.
+type bound struct {
+	version *version.Version
+
+	// exclusive is true if the version itself is outside the range.
+	exclusive bool
+}
+
+// compare returns a positive number if b is above other, a negative number if
+// b is below other, or zero if they are the same. upper says whether the
+// bounds are both upper bounds or both lower bounds, which decides where an
+// unbounded or exclusive bound sits.
+func (b bound) compare(other bound, upper bool) int {
+	unbounded := -1
+	if upper {
+		unbounded = 1
+	}
+
+	switch {
+	case b.version == nil && other.version == nil:
+		return 0
+	case b.version == nil:
+		return unbounded
+	case other.version == nil:
+		return -unbounded
+	}
+
+	if compare := b.version.Compare(other.version); compare != 0 {
+		return compare
+	}
+
+	// An exclusive lower bound is just above the version, while an exclusive
+	// upper bound is just below it.
+	switch {
+	case b.exclusive == other.exclusive:
+		return 0
+	case b.exclusive:
+		return -unbounded
+	default:
+		return unbounded
+	}
+}
+
+// constraintOperators are the operators supported by go-version, with the
+// longer operators first so they are matched before their prefixes.
+var constraintOperators = []string{"~>", ">=", "<=", "!=", ">", "<", "="}
+
+// bounds returns the lowest and highest versions accepted by the constraints
+// of the variant.
+func (v variant) bounds() (lower bound, upper bound) {
+	for _, constraint := range v.constraints {
+		operator, raw := "=", strings.TrimSpace(constraint.String())
+		for _, candidate := range constraintOperators {
+			if strings.HasPrefix(raw, candidate) {
+				operator, raw = candidate, strings.TrimSpace(strings.TrimPrefix(raw, candidate))
+				break
+			}
+		}
+
+		// The constraint has already been parsed, so this can't fail.
+		parsed, err := version.NewVersion(raw)
+		if err != nil {
+			continue
+		}
+
+		var low, high *bound
+		switch operator {
+		case "=":
+			low, high = &bound{version: parsed}, &bound{version: parsed}
+		case ">=":
+			low = &bound{version: parsed}
+		case ">":
+			low = &bound{version: parsed, exclusive: true}
+		case "<=":
+			high = &bound{version: parsed}
+		case "<":
+			high = &bound{version: parsed, exclusive: true}
+		case "~>":
+			low = &bound{version: parsed}
+			if next := pessimisticLimit(raw, parsed); next != nil {
+				high = &bound{version: next, exclusive: true}
+			}
+		}
+
+		if low != nil && low.compare(lower, false) > 0 {
+			lower = *low
+		}
+		if high != nil && high.compare(upper, true) < 0 {
+			upper = *high
+		}
+	}
+	return lower, upper
+}
+
+// pessimisticLimit returns the first version that a ~> constraint on target
+// excludes, eg. 1.3.0 for ~> 1.2.3 and 2.0.0 for ~> 1.2. A constraint with a
+// single segment has no limit, so nil is returned.
+func pessimisticLimit(target string, v *version.Version) *version.Version {
+	segments := strings.Count(strings.SplitN(target, "-", 2)[0], ".") + 1
+	if segments < 2 {
+		return nil
+	}
+
+	limit := v.Segments()[:segments-1]
+	limit[len(limit)-1]++
+
+	parts := make([]string, len(limit))
+	for ix, segment := range limit {
+		parts[ix] = fmt.Sprint(segment)
+	}
+
+	next, err := version.NewVersion(strings.Join(parts, "."))
+	if err != nil {
+		return nil
+	}
+	return next
+}
+
+// SelectVariant returns the name of the golden variant directory, within
+// directory, that should be used for the given binary flavor and version. If
+// no variants match, then an empty string is returned meaning the default set
+// of golden files should be used.
+//
+// If multiple variants match, the most specific is chosen. If multiple
+// variants are equally specific, the one that names a flavor or has the
+// narrowest version range is chosen, see variant.preferredTo, and failing that
+// the one with the name that sorts last.
+func SelectVariant(directory string, flavor string, binaryVersion string) (string, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	// Prerelease binaries are matched as the release they precede, in the
+	// same way as requires_version.
+	v, err := coreVersion(binaryVersion)
+	if err != nil {
+		return "", err
+	}
+
+	var selected *variant
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), VariantPrefix) {
+			continue
+		}
+
+		candidate, err := parseVariant(entry.Name())
+		if err != nil {
+			return "", err
+		}
+
+		if !candidate.matches(flavor, v) {
+			continue
+		}
+
+		// os.ReadDir returns the entries sorted by name, so replacing
+		// variants that can't be told apart means the last one wins.
+		if selected == nil || candidate.preferredTo(*selected) {
+			selected = &candidate
+		}
+	}
+
+	if selected == nil {
+		return "", nil
+	}
+	return selected.name, nil
+}
+
+// isVariant returns true if the named entry in a golden files directory is a
+// variant directory rather than a golden file.
+func isVariant(name string) bool {
+	return strings.HasPrefix(name, VariantPrefix)
+}
+
+// removeGoldenFiles deletes every golden file from directory, while leaving
+// any variant directories alone.
+func removeGoldenFiles(directory string) error {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if isVariant(entry.Name()) {
+			continue
+		}
+		if err := os.RemoveAll(path.Join(directory, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
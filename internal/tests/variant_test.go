@@ -0,0 +1,117 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tests
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSelectVariant(t *testing.T) {
+	directory := t.TempDir()
+	for _, name := range []string{"@>=1.6", "@>=1.7", "@tofu", "@tofu>=1.7,<1.8", "@terraform"} {
+		if err := os.Mkdir(path.Join(directory, name), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcs := []struct {
+		flavor   string
+		version  string
+		expected string
+	}{
+		{flavor: "opentf", version: "1.5.0", expected: ""},
+		{flavor: "opentf", version: "1.6.2", expected: "@>=1.6"},
+		{flavor: "opentf", version: "1.7.0", expected: "@>=1.7"},
+		{flavor: "tofu", version: "1.5.0", expected: "@tofu"},
+		{flavor: "tofu", version: "1.6.0", expected: "@tofu"},
+		{flavor: "tofu", version: "1.7.1", expected: "@tofu>=1.7,<1.8"},
+		{flavor: "tofu", version: "1.7.0-dev", expected: "@tofu>=1.7,<1.8"},
+		{flavor: "opentf", version: "1.7.0-alpha1", expected: "@>=1.7"},
+		{flavor: "tofu", version: "1.8.0", expected: "@tofu"},
+		{flavor: "terraform", version: "1.5.0", expected: "@terraform"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.flavor+"_"+tc.version, func(t *testing.T) {
+			variant, err := SelectVariant(directory, tc.flavor, tc.version)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if variant != tc.expected {
+				t.Errorf("expected %q but found %q", tc.expected, variant)
+			}
+		})
+	}
+}
+
+func TestSelectVariantNarrowest(t *testing.T) {
+	tcs := map[string]struct {
+		variants []string
+		version  string
+		expected string
+	}{
+		"higher lower bound": {
+			variants: []string{"@>=1.9", "@>=1.10"},
+			version:  "1.10.0",
+			expected: "@>=1.10",
+		},
+		"lower upper bound": {
+			variants: []string{"@<1.7", "@<1.8"},
+			version:  "1.6.0",
+			expected: "@<1.7",
+		},
+		"exclusive lower bound": {
+			variants: []string{"@>1.6", "@>=1.6"},
+			version:  "1.7.0",
+			expected: "@>1.6",
+		},
+		"pessimistic": {
+			variants: []string{"@>=1.6", "@~>1.6"},
+			version:  "1.7.0",
+			expected: "@~>1.6",
+		},
+		"exact": {
+			variants: []string{"@1.6.0", "@>=1.6"},
+			version:  "1.6.0",
+			expected: "@1.6.0",
+		},
+		"identical ranges": {
+			variants: []string{"@>= 1.6", "@>=1.6"},
+			version:  "1.6.0",
+			expected: "@>=1.6",
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			directory := t.TempDir()
+			for _, variant := range tc.variants {
+				if err := os.Mkdir(path.Join(directory, variant), os.ModePerm); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			variant, err := SelectVariant(directory, "tofu", tc.version)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if variant != tc.expected {
+				t.Errorf("expected %q but found %q", tc.expected, variant)
+			}
+		})
+	}
+}
+
+func TestSelectVariantInvalid(t *testing.T) {
+	directory := t.TempDir()
+	if err := os.Mkdir(path.Join(directory, "@>=bacon"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SelectVariant(directory, "tofu", "1.6.0"); err == nil {
+		t.Errorf("expected an error for an invalid variant")
+	}
+}
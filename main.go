@@ -27,7 +27,8 @@ func main() {
 
 	command.Args = os.Args[1:]
 	command.Commands = map[string]cli.CommandFactory{
-		"update": cmd.UpdateCommandFactory(&ui),
+		"update":  cmd.UpdateCommandFactory(&ui),
+		"convert": cmd.ConvertCommandFactory(&ui),
 	}
 	command.HelpFunc = cli.BasicHelpFunc("equivalence-testing")
 	command.HelpWriter = os.Stdout